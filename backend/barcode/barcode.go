@@ -0,0 +1,51 @@
+// Package barcode validates the product barcodes printed on packaged food.
+package barcode
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrFormat     = errors.New("barcode must be 12 digits (UPC-A) or 13 digits (EAN-13)")
+	ErrCheckDigit = errors.New("barcode check digit doesn't match")
+)
+
+// Normalize validates an EAN-13 or UPC-A code and returns it as 13 digits.
+// A UPC-A code is the EAN-13 code with a leading 0, so both spellings of a
+// product find the same food. Spaces and dashes are ignored.
+func Normalize(code string) (string, error) {
+	code = strings.NewReplacer(" ", "", "-", "").Replace(code)
+	for _, c := range code {
+		if c < '0' || c > '9' {
+			return "", ErrFormat
+		}
+	}
+
+	switch len(code) {
+	case 12:
+		code = "0" + code
+	case 13:
+	default:
+		return "", ErrFormat
+	}
+
+	if checkDigit(code[:12]) != code[12] {
+		return "", ErrCheckDigit
+	}
+	return code, nil
+}
+
+// checkDigit computes the EAN-13 check digit for the first 12 digits:
+// digits are weighted 1 and 3 alternately from the left.
+func checkDigit(digits string) byte {
+	sum := 0
+	for i := range len(digits) {
+		d := int(digits[i] - '0')
+		if i%2 == 1 {
+			d *= 3
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10)
+}
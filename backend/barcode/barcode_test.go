@@ -0,0 +1,60 @@
+package barcode
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		code    string
+		want    string
+		wantErr error
+	}{
+		{"4006381333931", "4006381333931", nil},
+		{"5449000000996", "5449000000996", nil},
+		{"036000291452", "0036000291452", nil},  // UPC-A
+		{"0036000291452", "0036000291452", nil}, // The same product as EAN-13
+		{"012345678905", "0012345678905", nil},
+		{"4006381 333931", "4006381333931", nil},
+		{"400-6381-33393-1", "4006381333931", nil},
+		{"4006381333932", "", ErrCheckDigit},
+		{"036000291453", "", ErrCheckDigit},
+		{"400638133393", "", ErrCheckDigit}, // EAN-13 missing its last digit
+		{"40063813339", "", ErrFormat},
+		{"40063813339310", "", ErrFormat},
+		{"400638133393a", "", ErrFormat},
+		{"", "", ErrFormat},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			got, err := Normalize(tt.code)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Normalize(%q) error = %v, want %v", tt.code, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Normalize(%q) = %q, want %q", tt.code, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckDigit(t *testing.T) {
+	tests := []struct {
+		digits string
+		want   byte
+	}{
+		{"400638133393", '1'},
+		{"544900000099", '6'},
+		{"003600029145", '2'},
+		{"000000000000", '0'},
+		{"000000000001", '7'},
+	}
+
+	for _, tt := range tests {
+		if got := checkDigit(tt.digits); got != tt.want {
+			t.Errorf("checkDigit(%q) = %c, want %c", tt.digits, got, tt.want)
+		}
+	}
+}
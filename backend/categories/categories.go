@@ -0,0 +1,245 @@
+// Package categories is the fixed tree of food categories, such as
+// protein > poultry > chicken, and matches free-text categories to it.
+package categories
+
+import (
+	"maps"
+	"strings"
+
+	"myjunkpal/search"
+)
+
+// Node is a category. Slugs are unique across the whole tree, so a food
+// only stores its category's slug.
+type Node struct {
+	Slug     string
+	Name     string
+	Parent   *Node
+	Children []*Node
+
+	aliases []string // Other names matched by Match, e.g. "steak" for beef
+}
+
+func node(slug, name string, aliases []string, children ...*Node) *Node {
+	n := &Node{Slug: slug, Name: name, Children: children, aliases: aliases}
+	for _, c := range children {
+		c.Parent = n
+	}
+	return n
+}
+
+var roots = []*Node{
+	node("protein", "Protein", []string{"meat and fish", "meats"},
+		node("poultry", "Poultry", nil,
+			node("chicken", "Chicken", nil),
+			node("turkey", "Turkey", nil),
+			node("duck", "Duck", nil)),
+		node("meat", "Meat", []string{"red meat"},
+			node("beef", "Beef", []string{"steak", "veal", "mince"}),
+			node("pork", "Pork", []string{"ham", "bacon"}),
+			node("lamb", "Lamb", []string{"mutton"}),
+			node("processed-meat", "Processed meat", []string{"sausage", "salami", "deli meat", "cold cuts", "hot dog"})),
+		node("seafood", "Seafood", []string{"fish and seafood"},
+			node("fish", "Fish", []string{"salmon", "tuna", "cod", "sardine", "mackerel", "trout"}),
+			node("shellfish", "Shellfish", []string{"shrimp", "prawn", "crab", "lobster", "mussel", "oyster", "squid"})),
+		node("eggs", "Eggs", nil),
+		node("plant-protein", "Plant protein", nil,
+			node("legumes", "Legumes", []string{"bean", "lentil", "chickpea", "pulse", "hummus"}),
+			node("tofu", "Tofu and tempeh", []string{"tempeh", "seitan", "meat alternative"}))),
+	node("dairy", "Dairy", []string{"dairies", "dairy product"},
+		node("milk", "Milk", nil),
+		node("cheese", "Cheese", nil),
+		node("yogurt", "Yogurt", []string{"yoghurt", "kefir", "skyr"}),
+		node("cream", "Cream", []string{"sour cream", "creme fraiche"})),
+	node("grains", "Grains", []string{"grain", "starch", "cereals and potatoes"},
+		node("rice", "Rice", nil),
+		node("bread", "Bread", []string{"toast", "bagel", "tortilla", "wrap", "bun"}),
+		node("pasta", "Pasta", []string{"noodle", "spaghetti", "macaroni"}),
+		node("cereals", "Breakfast cereals", []string{"cereal", "oats", "oatmeal", "porridge", "granola", "muesli"})),
+	node("vegetables", "Vegetables", []string{"veg", "veggie"},
+		node("leafy-greens", "Leafy greens", []string{"spinach", "lettuce", "kale", "salad greens"}),
+		node("root-vegetables", "Root vegetables", []string{"potato", "sweet potato", "carrot", "beet", "turnip"}),
+		node("cruciferous", "Cruciferous vegetables", []string{"broccoli", "cauliflower", "cabbage", "brussels sprout"}),
+		node("mushrooms", "Mushrooms", nil)),
+	node("fruit", "Fruit", []string{"fruits"},
+		node("berries", "Berries", []string{"berry", "strawberry", "blueberry", "raspberry"}),
+		node("citrus", "Citrus", []string{"orange", "lemon", "lime", "grapefruit"}),
+		node("tropical-fruit", "Tropical fruit", []string{"banana", "mango", "pineapple", "papaya", "avocado"}),
+		node("orchard-fruit", "Apples and pears", []string{"apple", "pear", "peach", "plum", "cherry", "apricot"}),
+		node("dried-fruit", "Dried fruit", []string{"raisin", "date", "prune"})),
+	node("nuts-seeds", "Nuts and seeds", nil,
+		node("nuts", "Nuts", []string{"nut", "almond", "walnut", "cashew", "peanut"}),
+		node("seeds", "Seeds", []string{"chia", "flaxseed", "sunflower seed"}),
+		node("nut-butters", "Nut butters", []string{"peanut butter", "almond butter", "tahini"})),
+	node("fats-oils", "Fats and oils", []string{"fat", "fats"},
+		node("oils", "Oils", []string{"oil", "olive oil"}),
+		node("butter", "Butter", []string{"margarine", "ghee"})),
+	node("beverages", "Beverages", []string{"beverage", "drink", "drinks"},
+		node("water", "Water", nil),
+		node("coffee-tea", "Coffee and tea", []string{"coffee", "tea"}),
+		node("juice", "Juice", []string{"juices", "smoothie"}),
+		node("soft-drinks", "Soft drinks", []string{"soda", "sodas", "energy drink"}),
+		node("plant-milk", "Plant milk", []string{"almond milk", "oat milk", "soy milk"}),
+		node("alcohol", "Alcohol", []string{"alcoholic beverage", "beer", "wine", "spirit", "cocktail"})),
+	node("snacks", "Snacks", []string{"snack", "salty snack"},
+		node("chips", "Chips", []string{"crisps", "pretzel"}),
+		node("crackers", "Crackers", []string{"rice cake"}),
+		node("bars", "Bars", []string{"protein bar", "granola bar", "cereal bar", "snack bar"}),
+		node("popcorn", "Popcorn", nil)),
+	node("sweets", "Sweets", []string{"sweet", "sugary snack", "confectionery"},
+		node("chocolate", "Chocolate", []string{"chocolates", "cocoa"}),
+		node("candy", "Candy", []string{"candies", "gummy"}),
+		node("desserts", "Desserts", []string{"dessert", "cake", "cookie", "biscuit", "pastry", "ice cream", "pudding"})),
+	node("condiments", "Condiments", []string{"condiment"},
+		node("sauces", "Sauces", []string{"sauce", "ketchup", "mayonnaise", "mustard", "dressing", "salsa"}),
+		node("spreads", "Spreads", []string{"spread", "jam", "honey", "syrup"}),
+		node("spices", "Herbs and spices", []string{"spice", "herb", "seasoning", "salt"})),
+	node("meals", "Meals", []string{"meal", "dish", "dishes"},
+		node("prepared-meals", "Prepared meals", []string{"ready meal", "frozen meal"}),
+		node("soups", "Soups", []string{"soup", "stew"}),
+		node("sandwiches", "Sandwiches", []string{"sandwich", "burger"}),
+		node("pizza", "Pizza", nil),
+		node("salads", "Salads", []string{"salad"})),
+	node("supplements", "Supplements", []string{"supplement", "dietary supplement"},
+		node("protein-powder", "Protein powder", []string{"whey", "protein shake"})),
+}
+
+// Categories too broad to say anything, such as Open Food Facts' top
+// level, match nothing so the food's name is used instead.
+var vague = map[string]bool{
+	"plant based foods and beverages": true, "plant based foods": true, "foods": true,
+	"groceries": true, "other": true, "misc": true, "miscellaneous": true, "uncategorized": true,
+}
+
+// bySlug indexes every node by its slug.
+var bySlug = func() map[string]*Node {
+	m := make(map[string]*Node)
+	walk(roots, func(n *Node) { m[n.Slug] = n })
+	return m
+}()
+
+// byKey indexes every node by the keys of its slug and name, for Lookup.
+var byKey = func() map[string]*Node {
+	m := make(map[string]*Node)
+	walk(roots, func(n *Node) {
+		m[key(n.Slug)] = n
+		m[key(n.Name)] = n
+	})
+	return m
+}()
+
+// byName adds the aliases, and singular forms of all of them, for Match.
+var byName = func() map[string]*Node {
+	m := make(map[string]*Node)
+	walk(roots, func(n *Node) {
+		for _, s := range append([]string{n.Slug, n.Name}, n.aliases...) {
+			m[key(s)] = n
+		}
+	})
+	plurals := maps.Clone(m)
+	for k, n := range plurals {
+		if _, ok := m[search.Singular(k)]; !ok {
+			m[search.Singular(k)] = n
+		}
+	}
+	return m
+}()
+
+func walk(nodes []*Node, fn func(n *Node)) {
+	for _, n := range nodes {
+		fn(n)
+		walk(n.Children, fn)
+	}
+}
+
+// Roots returns the top-level categories.
+func Roots() []*Node {
+	return roots
+}
+
+// Lookup finds a category by its slug or name, ignoring case and
+// spacing, so "Leafy greens" finds leafy-greens.
+func Lookup(s string) (*Node, bool) {
+	n, ok := byKey[key(s)]
+	return n, ok
+}
+
+// Path returns the slugs from the root category down to n.
+func (n *Node) Path() []string {
+	var path []string
+	for ; n != nil; n = n.Parent {
+		path = append([]string{n.Slug}, path...)
+	}
+	return path
+}
+
+// Contains reports whether the category with the given slug is n or one
+// of its descendants.
+func (n *Node) Contains(slug string) bool {
+	for c := bySlug[slug]; c != nil; c = c.Parent {
+		if c == n {
+			return true
+		}
+	}
+	return false
+}
+
+// Match finds the category a free-text category or food name most likely
+// means, trying the whole text and then shorter runs of its words from the
+// end, where English puts the noun: "Breakfast Cereals" is cereals and
+// "frozen chicken breasts" is chicken. Aliases and simple plurals count.
+func Match(text string) (*Node, bool) {
+	return match(text, nil)
+}
+
+// Classify picks the category for a food from its free-text category,
+// refined by its name when that names a more specific category below, so
+// a "protein" called "Chicken Breast" is chicken. A category that doesn't
+// match anything falls back to the name alone.
+func Classify(category, name string) (*Node, bool) {
+	n, ok := Match(category)
+	if !ok {
+		return Match(name)
+	}
+	if sub, ok := match(name, n); ok {
+		return sub, true
+	}
+	return n, true
+}
+
+// match is Match, taking only categories strictly below within when it's
+// set.
+func match(text string, within *Node) (*Node, bool) {
+	if vague[key(text)] {
+		return nil, false
+	}
+
+	words := strings.Fields(key(text))
+	for size := len(words); size > 0; size-- {
+		for start := len(words) - size; start >= 0; start-- {
+			phrase := strings.Join(words[start:start+size], " ")
+			for _, k := range []string{phrase, search.Singular(phrase)} {
+				n, ok := byName[k]
+				if ok && (within == nil || n != within && within.Contains(n.Slug)) {
+					return n, true
+				}
+			}
+		}
+	}
+	return nil, false
+}
+
+// key normalizes a category for matching: lower case, without a language
+// prefix like "en:", and with punctuation turned into single spaces.
+func key(s string) string {
+	if prefix, rest, ok := strings.Cut(s, ":"); ok && len(prefix) == 2 {
+		s = rest
+	}
+	s = strings.Map(func(r rune) rune {
+		if r == '-' || r == '_' || r == '&' || r == ',' || r == '/' || r == '>' || r == '(' || r == ')' {
+			return ' '
+		}
+		return r
+	}, strings.ToLower(s))
+	return strings.Join(strings.Fields(s), " ")
+}
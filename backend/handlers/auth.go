@@ -2,23 +2,25 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"time"
 
+	"myjunkpal/intake"
 	"myjunkpal/models"
 	"myjunkpal/storage"
 
 	"github.com/google/uuid"
 )
 
-var CurrentUser *models.User
-
 type AuthHandler struct {
-	store *storage.JSONStore
+	users  storage.UserRepo
+	tokens *TokenManager
 }
 
-func NewAuthHandler(store *storage.JSONStore) *AuthHandler {
-	return &AuthHandler{store: store}
+func NewAuthHandler(users storage.UserRepo, tokens *TokenManager) *AuthHandler {
+	return &AuthHandler{users: users, tokens: tokens}
 }
 
 func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
@@ -28,46 +30,53 @@ func (h *AuthHandler) Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Load existing users
-	var users []models.User
-	h.store.LoadFromFile("users.json", &users)
+	if len(req.Password) > maxPasswordLength {
+		http.Error(w, fmt.Sprintf("Password must be at most %d bytes", maxPasswordLength), http.StatusBadRequest)
+		return
+	}
+
+	if err := checkProfile(req.Age, req.Sex, req.Weight); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
 	// Check if user already exists
-	for _, u := range users {
-		if u.Email == req.Email {
-			http.Error(w, "User already exists", http.StatusConflict)
-			return
-		}
+	_, err := h.users.GetUserByEmail(req.Email)
+	if err == nil {
+		http.Error(w, "User already exists", http.StatusConflict)
+		return
+	}
+	if !errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	// Create new user
-	user := models.User{
-		ID:               uuid.New().String(),
-		Email:            req.Email,
-		Name:             req.Name,
-		Password:         req.Password,
-		DailyCalorieGoal: 2000,
-		DailyProteinGoal: 150,
-		DailyCarbsGoal:   250,
-		DailyFatsGoal:    65,
-		CreatedAt:        time.Now(),
+	hash, err := hashPassword(req.Password)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	users = append(users, user)
+	// Create new user, with goals from the reference intakes for their profile
+	user := models.User{
+		ID:             uuid.New().String(),
+		Email:          req.Email,
+		Name:           req.Name,
+		Password:       hash,
+		CreatedAt:      time.Now(),
+		Age:            req.Age,
+		Sex:            req.Sex,
+		Weight:         req.Weight,
+		NutritionGoals: intake.Goals(req.Age, req.Sex, req.Weight),
+	}
 
-	// Save to file
-	if err := h.store.SaveToFile("users.json", users); err != nil {
+	if err := h.users.CreateUser(user); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	// Auto-login after registration
-	CurrentUser = &user
-
-	// Don't send password back
-	user.Password = ""
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(user)
+	h.writeTokens(w, user)
 }
 
 func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
@@ -77,32 +86,203 @@ func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Load users
-	var users []models.User
-	h.store.LoadFromFile("users.json", &users)
-
 	// Find user
-	for _, u := range users {
-		if u.Email == req.Email && u.Password == req.Password {
-			CurrentUser = &u
-			u.Password = ""
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(u)
+	user, err := h.users.GetUserByEmail(req.Email)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ok, needsRehash := checkPassword(user.Password, req.Password)
+	if !ok {
+		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+		return
+	}
+
+	// Upgrade plaintext or weaker hashes now that we know the password;
+	// plaintext too long for bcrypt has to stay as it is
+	if needsRehash && len(req.Password) <= maxPasswordLength {
+		hash, err := hashPassword(req.Password)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		user.Password = hash
+		if err := h.users.UpdateUser(*user); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 	}
 
-	http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	h.writeTokens(w, *user)
 }
 
 func (h *AuthHandler) GetCurrentUser(w http.ResponseWriter, r *http.Request) {
-	if CurrentUser == nil {
+	currentUser := UserFromContext(r.Context())
+	if currentUser == nil {
 		http.Error(w, "Not logged in", http.StatusUnauthorized)
 		return
 	}
 
-	user := *CurrentUser
+	user := *currentUser
+	user.Password = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// UpdateCurrentUser sets the fields of the current user's profile that
+// the request gives, leaving the others as they are.
+func (h *AuthHandler) UpdateCurrentUser(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
+	var req models.UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user := *currentUser
+	if req.Age != nil {
+		user.Age = *req.Age
+	}
+	if req.Sex != nil {
+		user.Sex = *req.Sex
+	}
+	if req.Weight != nil {
+		user.Weight = *req.Weight
+	}
+	if err := checkProfile(user.Age, user.Sex, user.Weight); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Allergens != nil {
+		allergens := normalizeLabels(*req.Allergens)
+		if err := checkLabels("allergen", allergens, models.Allergens); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		user.Allergens = allergens
+	}
+
+	err := h.users.UpdateUser(user)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
 	user.Password = ""
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(user)
 }
+
+// checkProfile validates the optional profile fields, where zero values
+// mean not given.
+func checkProfile(age int, sex string, weight float64) error {
+	if age < 0 || age > 130 {
+		return errors.New("Age must be between 1 and 130, or 0 if not given")
+	}
+	if sex != "" && sex != intake.Male && sex != intake.Female {
+		return fmt.Errorf("Sex must be %q or %q", intake.Male, intake.Female)
+	}
+	if weight != 0 && (weight < 1 || weight > 650) {
+		return errors.New("Weight must be in kg, between 1 and 650, or 0 if not given")
+	}
+	return nil
+}
+
+func (h *AuthHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	var req models.RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	claims, err := h.tokens.Validate(req.RefreshToken, RefreshToken)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// Refresh tokens are single use; if another request just used this
+	// one, only it gets a new pair
+	err = h.tokens.Revoke(claims)
+	if errors.Is(err, ErrTokenRevoked) {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	user, err := h.users.GetUser(claims.Subject)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.writeTokens(w, *user)
+}
+
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	var req models.LogoutRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// An expired or invalid access token logs nobody in already, but the
+	// refresh token sent with it may still be good
+	access, err := h.tokens.Validate(BearerToken(r), AccessToken)
+	if err == nil {
+		if err := h.tokens.Revoke(access); err != nil && !errors.Is(err, ErrTokenRevoked) {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	// Revoke the refresh token too so the client can't silently log back in
+	if req.RefreshToken != "" {
+		refresh, err := h.tokens.Validate(req.RefreshToken, RefreshToken)
+		if err == nil && (access == nil || refresh.Subject == access.Subject) {
+			if err := h.tokens.Revoke(refresh); err != nil && !errors.Is(err, ErrTokenRevoked) {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeTokens issues a fresh token pair for user and writes it alongside
+// the user record.
+func (h *AuthHandler) writeTokens(w http.ResponseWriter, user models.User) {
+	// Don't send password back
+	user.Password = ""
+
+	resp, err := h.tokens.Issue(user)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"myjunkpal/categories"
+	"myjunkpal/models"
+)
+
+// GetCategories lists the category tree, top-level categories first with
+// their subcategories nested inside.
+func (h *FoodHandler) GetCategories(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(categoryList(categories.Roots()))
+}
+
+func categoryList(nodes []*categories.Node) []models.Category {
+	list := make([]models.Category, 0, len(nodes))
+	for _, n := range nodes {
+		list = append(list, models.Category{
+			Slug:     n.Slug,
+			Name:     n.Name,
+			Path:     n.Path(),
+			Children: categoryList(n.Children),
+		})
+	}
+	return list
+}
+
+// checkCategory returns the slug of a category given by slug or name, or
+// "" for none. Unknown categories are an error, suggesting the closest
+// match when there is one.
+func checkCategory(category string) (string, error) {
+	if category == "" {
+		return "", nil
+	}
+	if n, ok := categories.Lookup(category); ok {
+		return n.Slug, nil
+	}
+
+	if n, ok := categories.Match(category); ok {
+		return "", fmt.Errorf("Unknown category %q, did you mean %q? See GET /api/categories", category, n.Slug)
+	}
+	return "", fmt.Errorf("Unknown category %q, see GET /api/categories", category)
+}
@@ -0,0 +1,232 @@
+package handlers
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+
+	"myjunkpal/models"
+	"myjunkpal/search"
+	"myjunkpal/storage"
+	"myjunkpal/units"
+)
+
+// Foods are duplicates when their names score this well against each
+// other, so "Greek Yogurt" pairs with "greek yoghurt" and "Greek Yogurt,
+// plain" but not with "Greek Salad".
+const duplicateNameThreshold = 0.8
+
+// Their calories and macros must also agree to within this fraction, or
+// duplicateSlack when that's larger, for labels that round differently.
+const duplicateTolerance = 0.15
+
+var duplicateSlack = [4]float64{10, 2, 2, 2} // kcal, g, g, g per 100 g
+
+// GetDuplicates groups the user's custom foods with the foods, custom or
+// system, that look like the same food: a similar name and similar
+// nutrition. Recipes are left out. Each group suggests the food to merge
+// the others into.
+func (h *FoodHandler) GetDuplicates(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
+	foods, err := h.foods.FoodsVisibleTo(currentUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	foods = slices.DeleteFunc(foods, func(f models.Food) bool { return f.IsRecipe() })
+
+	logged, err := h.logCounts(currentUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Union-find over the foods, joining each custom food with its matches
+	parent := make(map[int]int)
+	var find func(i int) int
+	find = func(i int) int {
+		p, ok := parent[i]
+		if !ok || p == i {
+			return i
+		}
+		parent[i] = find(p)
+		return parent[i]
+	}
+
+	ix, err := h.foods.SearchIndex()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	byID := make(map[string]int, len(foods))
+	names := make([][]string, len(foods))
+	for i, f := range foods {
+		byID[f.ID] = i
+		names[i] = search.Tokens(f.Name)
+	}
+
+	for i := range foods {
+		if foods[i].UserID != currentUser.ID || len(names[i]) == 0 {
+			continue
+		}
+		for id := range ix.Candidates(names[i]) {
+			j, ok := byID[id]
+			if !ok || j == i || search.Score(names[i], names[j]) < duplicateNameThreshold || !similarNutrition(&foods[i], &foods[j]) {
+				continue
+			}
+			root := find(i)
+			parent[root] = root
+			parent[find(j)] = root
+		}
+	}
+
+	members := make(map[int][]int)
+	for i := range parent {
+		root := find(i)
+		members[root] = append(members[root], i)
+	}
+
+	groups := []models.DuplicateGroup{}
+	for _, idx := range members {
+		if len(idx) < 2 {
+			continue
+		}
+
+		group := models.DuplicateGroup{}
+		for _, i := range idx {
+			group.Foods = append(group.Foods, models.DuplicateFood{Food: foods[i], Entries: logged[foods[i].ID]})
+		}
+		// The suggested target comes first: a system food, which every
+		// user shares, else the most logged food, else the oldest
+		slices.SortFunc(group.Foods, func(a, b models.DuplicateFood) int {
+			if (a.UserID == "") != (b.UserID == "") {
+				if a.UserID == "" {
+					return -1
+				}
+				return 1
+			}
+			return cmp.Or(cmp.Compare(b.Entries, a.Entries), a.CreatedAt.Compare(b.CreatedAt), strings.Compare(a.ID, b.ID))
+		})
+		group.TargetID = group.Foods[0].ID
+		groups = append(groups, group)
+	}
+	slices.SortFunc(groups, func(a, b models.DuplicateGroup) int {
+		return strings.Compare(strings.ToLower(a.Foods[0].Name), strings.ToLower(b.Foods[0].Name))
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(groups)
+}
+
+// per100 returns a food's calories, protein, carbs and fats per 100 g or
+// 100 ml, and which of the two, or ok false for servings like "1 medium".
+func per100(f *models.Food) (values [4]float64, dim units.Dimension, ok bool) {
+	u, ok := units.Lookup(f.ServingUnit)
+	if !ok || f.ServingSize <= 0 {
+		return values, 0, false
+	}
+
+	scale := 100 / (f.ServingSize * u.Factor)
+	return [4]float64{f.Calories * scale, f.Protein * scale, f.Carbs * scale, f.Fats * scale}, u.Dimension, true
+}
+
+// similarNutrition compares two foods per 100 g or ml, or per serving
+// when both have the same serving that isn't a weight or volume.
+func similarNutrition(a, b *models.Food) bool {
+	va, da, okA := per100(a)
+	vb, db, okB := per100(b)
+	if !okA || !okB || da != db {
+		if !strings.EqualFold(a.ServingUnit, b.ServingUnit) || a.ServingSize != b.ServingSize {
+			return false
+		}
+		va = [4]float64{a.Calories, a.Protein, a.Carbs, a.Fats}
+		vb = [4]float64{b.Calories, b.Protein, b.Carbs, b.Fats}
+	}
+
+	for i := range va {
+		if math.Abs(va[i]-vb[i]) > max(duplicateTolerance*max(va[i], vb[i]), duplicateSlack[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// MergeFoods merges some of the user's custom foods into another food,
+// custom or system: their entries and recipe ingredients move onto it,
+// converted to its servings where the units allow and recalculated, so
+// each entry's food_name becomes the target's. The merged foods are then
+// deleted.
+func (h *FoodHandler) MergeFoods(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
+	var req models.MergeFoodsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.TargetID == "" || len(req.FoodIDs) == 0 {
+		http.Error(w, "Give the food to merge into in target_id and the foods to merge in food_ids", http.StatusBadRequest)
+		return
+	}
+
+	target, err := h.foods.GetFood(req.TargetID)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && (target.UserID != "" && target.UserID != currentUser.ID || !target.ArchivedAt.IsZero())) {
+		http.Error(w, "Target food not found", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Check every food before changing any
+	var sources []*models.Food
+	for _, id := range req.FoodIDs {
+		if id == target.ID || slices.ContainsFunc(sources, func(f *models.Food) bool { return f.ID == id }) {
+			continue
+		}
+
+		food, err := h.foods.GetFood(id)
+		if errors.Is(err, storage.ErrNotFound) || (err == nil && food.UserID != "" && food.UserID != currentUser.ID) {
+			http.Error(w, fmt.Sprintf("Food %s not found", id), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if food.UserID != currentUser.ID {
+			http.Error(w, fmt.Sprintf("%s is a system food; only your own foods can be merged into another", food.Name), http.StatusForbidden)
+			return
+		}
+		sources = append(sources, food)
+	}
+
+	resp := models.MergeFoodsResponse{TargetID: target.ID, Merged: []string{}, Skipped: []string{}}
+	for _, food := range sources {
+		entries, recipes, err := h.replace(food, target)
+		resp.Entries += entries
+		resp.Recipes += recipes
+
+		// Whatever still uses a food edited mid-merge keeps it, archived
+		switch {
+		case err == nil:
+			resp.Merged = append(resp.Merged, food.ID)
+		case errors.Is(err, storage.ErrInUse), errors.Is(err, storage.ErrVersionConflict), errors.Is(err, storage.ErrNotFound):
+			resp.Skipped = append(resp.Skipped, food.ID)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"slices"
 	"time"
 
 	"myjunkpal/models"
@@ -13,47 +16,51 @@ import (
 )
 
 type EntryHandler struct {
-	store *storage.JSONStore
+	entries storage.EntryRepo
+	foods   storage.FoodRepo
 }
 
-func NewEntryHandler(store *storage.JSONStore) *EntryHandler {
-	return &EntryHandler{store: store}
+func NewEntryHandler(entries storage.EntryRepo, foods storage.FoodRepo) *EntryHandler {
+	return &EntryHandler{entries: entries, foods: foods}
 }
 
 func (h *EntryHandler) GetEntries(w http.ResponseWriter, r *http.Request) {
-	var entries []models.Entry
-	h.store.LoadFromFile("entries.json", &entries)
-
-	// Filter by user
-	var userEntries []models.Entry
-	for _, e := range entries {
-		if e.UserID == CurrentUser.ID {
-			userEntries = append(userEntries, e)
-		}
-	}
+	currentUser := UserFromContext(r.Context())
 
 	// Optional filters
 	startDate := r.URL.Query().Get("start_date")
 	endDate := r.URL.Query().Get("end_date")
 	mealType := r.URL.Query().Get("meal_type")
 
-	// Apply filters
-	var filtered []models.Entry
-	for _, e := range userEntries {
-		if startDate != "" {
-			start, _ := time.Parse("2006-01-02", startDate)
-			if e.EatenAt.Before(start) {
-				continue
-			}
+	var start, end time.Time
+	if startDate != "" {
+		var err error
+		start, err = time.Parse("2006-01-02", startDate)
+		if err != nil {
+			http.Error(w, "Invalid start_date format, use YYYY-MM-DD", http.StatusBadRequest)
+			return
 		}
+	}
 
-		if endDate != "" {
-			end, _ := time.Parse("2006-01-02", endDate)
-			if e.EatenAt.After(end.Add(24 * time.Hour)) {
-				continue
-			}
+	if endDate != "" {
+		day, err := time.Parse("2006-01-02", endDate)
+		if err != nil {
+			http.Error(w, "Invalid end_date format, use YYYY-MM-DD", http.StatusBadRequest)
+			return
 		}
+		// Include the whole end day
+		end = day.Add(24 * time.Hour)
+	}
+
+	entries, err := h.entries.EntriesForUserInRange(currentUser.ID, start, end)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
+	// Apply filters
+	var filtered []models.Entry
+	for _, e := range entries {
 		if mealType != "" && e.MealType != mealType {
 			continue
 		}
@@ -66,24 +73,33 @@ func (h *EntryHandler) GetEntries(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *EntryHandler) GetEntry(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	var entries []models.Entry
-	h.store.LoadFromFile("entries.json", &entries)
+	entry, err := h.entries.GetEntry(id)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && entry.UserID != currentUser.ID) {
+		http.Error(w, "Entry not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	for _, e := range entries {
-		if e.ID == id && e.UserID == CurrentUser.ID {
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(e)
-			return
-		}
+	if notModified(w, r, entry.Version) {
+		return
 	}
 
-	http.Error(w, "Entry not found", http.StatusNotFound)
+	setETag(w, entry.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
 }
 
 func (h *EntryHandler) CreateEntry(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
 	var req models.CreateEntryRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -91,19 +107,18 @@ func (h *EntryHandler) CreateEntry(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Load food to get nutritional info
-	var foods []models.Food
-	h.store.LoadFromFile("foods.json", &foods)
-
-	var food *models.Food
-	for _, f := range foods {
-		if f.ID == req.FoodID {
-			food = &f
-			break
-		}
+	food, err := h.foods.GetFood(req.FoodID)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && food.UserID != "" && food.UserID != currentUser.ID) {
+		http.Error(w, "Food not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	if food == nil {
-		http.Error(w, "Food not found", http.StatusNotFound)
+	if !food.ArchivedAt.IsZero() {
+		http.Error(w, "Food has been deleted", http.StatusConflict)
 		return
 	}
 
@@ -114,39 +129,51 @@ func (h *EntryHandler) CreateEntry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Load existing entries
-	var entries []models.Entry
-	h.store.LoadFromFile("entries.json", &entries)
-
 	// Create entry with calculated nutrition
 	entry := models.Entry{
 		ID:        uuid.New().String(),
-		UserID:    CurrentUser.ID,
+		UserID:    currentUser.ID,
 		FoodID:    req.FoodID,
-		FoodName:  food.Name,
-		Quantity:  req.Quantity,
 		MealType:  req.MealType,
 		EatenAt:   eatenAt,
-		Calories:  food.Calories * req.Quantity,
-		Protein:   food.Protein * req.Quantity,
-		Carbs:     food.Carbs * req.Quantity,
-		Fats:      food.Fats * req.Quantity,
+		Version:   1,
 		CreatedAt: time.Now(),
 	}
+	if err := setAmount(&entry, food, req.Quantity, req.Amount, req.Unit); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	applyFood(&entry, food)
 
-	entries = append(entries, entry)
-
-	if err := h.store.SaveToFile("entries.json", entries); err != nil {
+	if err := h.entries.CreateEntry(entry); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	setETag(w, entry.Version)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(entry)
+	json.NewEncoder(w).Encode(models.EntryResponse{Entry: entry, Warnings: allergenWarnings(currentUser, food)})
+}
+
+// allergenWarnings warns about each allergen in the user's profile that
+// the food contains. Logging it anyway is the user's call.
+func allergenWarnings(user *models.User, food *models.Food) []models.FieldError {
+	var warnings []models.FieldError
+	for _, a := range food.Allergens {
+		if slices.Contains(user.Allergens, a) {
+			warnings = append(warnings, models.FieldError{
+				Field:   "food_id",
+				Message: fmt.Sprintf("%s contains %s, which is in your allergen profile", food.Name, a),
+			})
+		}
+	}
+	return warnings
 }
 
 func (h *EntryHandler) UpdateEntry(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
 	vars := mux.Vars(r)
 	id := vars["id"]
 
@@ -156,79 +183,162 @@ func (h *EntryHandler) UpdateEntry(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var entries []models.Entry
-	h.store.LoadFromFile("entries.json", &entries)
-
-	for i, e := range entries {
-		if e.ID == id && e.UserID == CurrentUser.ID {
-			// Load food to recalculate nutrition
-			var foods []models.Food
-			h.store.LoadFromFile("foods.json", &foods)
-
-			var food *models.Food
-			for _, f := range foods {
-				if f.ID == e.FoodID {
-					food = &f
-					break
-				}
-			}
-
-			if food == nil {
-				http.Error(w, "Food not found", http.StatusNotFound)
-				return
-			}
-
-			// Parse eaten_at time
-			eatenAt, err := time.Parse(time.RFC3339, req.EatenAt)
-			if err != nil {
-				http.Error(w, "Invalid eaten_at format, use ISO8601", http.StatusBadRequest)
-				return
-			}
-
-			// Update fields
-			entries[i].Quantity = req.Quantity
-			entries[i].MealType = req.MealType
-			entries[i].EatenAt = eatenAt
-			entries[i].Calories = food.Calories * req.Quantity
-			entries[i].Protein = food.Protein * req.Quantity
-			entries[i].Carbs = food.Carbs * req.Quantity
-			entries[i].Fats = food.Fats * req.Quantity
-
-			if err := h.store.SaveToFile("entries.json", entries); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
-
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(entries[i])
-			return
-		}
+	entry, err := h.entries.GetEntry(id)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && entry.UserID != currentUser.ID) {
+		http.Error(w, "Entry not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if ifMatchFails(r, entry.Version) {
+		writePreconditionFailed(w)
+		return
+	}
+
+	// Recalculate from the food version the entry was logged against, so
+	// later edits to the food don't change it
+	food, err := h.foods.GetFoodRevision(entry.FoodID, entry.FoodVersion)
+	if errors.Is(err, storage.ErrNotFound) {
+		food, err = servingFromEntry(entry)
+	}
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Food not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Parse eaten_at time
+	eatenAt, err := time.Parse(time.RFC3339, req.EatenAt)
+	if err != nil {
+		http.Error(w, "Invalid eaten_at format, use ISO8601", http.StatusBadRequest)
+		return
+	}
+
+	// Update fields
+	if err := setAmount(entry, food, req.Quantity, req.Amount, req.Unit); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
+	entry.MealType = req.MealType
+	entry.EatenAt = eatenAt
+	applyFood(entry, food)
 
-	http.Error(w, "Entry not found", http.StatusNotFound)
+	err = h.entries.UpdateEntry(*entry)
+	if errors.Is(err, storage.ErrVersionConflict) {
+		writePreconditionFailed(w)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	entry.Version++
+
+	setETag(w, entry.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entry)
 }
 
 func (h *EntryHandler) DeleteEntry(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	var entries []models.Entry
-	h.store.LoadFromFile("entries.json", &entries)
+	entry, err := h.entries.GetEntry(id)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && entry.UserID != currentUser.ID) {
+		http.Error(w, "Entry not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if ifMatchFails(r, entry.Version) {
+		writePreconditionFailed(w)
+		return
+	}
+
+	err = h.entries.DeleteEntry(id, entry.Version)
+	if errors.Is(err, storage.ErrVersionConflict) {
+		writePreconditionFailed(w)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	for i, e := range entries {
-		if e.ID == id && e.UserID == CurrentUser.ID {
-			// Remove from slice
-			entries = append(entries[:i], entries[i+1:]...)
+	w.WriteHeader(http.StatusNoContent)
+}
 
-			if err := h.store.SaveToFile("entries.json", entries); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+// applyFood pins entry to food's version and recalculates its nutrition
+// from it for the entry's quantity.
+func applyFood(entry *models.Entry, food *models.Food) {
+	entry.FoodName = food.Name
+	entry.FoodVersion = food.Version
+	entry.Calories = food.Calories * entry.Quantity
+	entry.Protein = food.Protein * entry.Quantity
+	entry.Carbs = food.Carbs * entry.Quantity
+	entry.Fats = food.Fats * entry.Quantity
+	entry.Micronutrients = food.Micronutrients.Scale(entry.Quantity)
+}
 
-			w.WriteHeader(http.StatusNoContent)
-			return
+// setAmount sets how much of food entry is for, either as a number of
+// servings or as an amount in a unit, which is converted to servings.
+func setAmount(entry *models.Entry, food *models.Food, quantity, amount float64, unit string) error {
+	if unit == "" {
+		if amount != 0 {
+			return errors.New("Give a unit with amount")
+		}
+		if !positive(quantity) {
+			return errors.New("Quantity must be positive")
 		}
+		entry.Quantity, entry.Amount, entry.Unit = quantity, 0, ""
+		return nil
+	}
+
+	if quantity != 0 {
+		return errors.New("Give either quantity or amount and unit, not both")
+	}
+	if !positive(amount) {
+		return errors.New("Amount must be positive")
+	}
+	servings, err := servingsFor(food, amount, unit)
+	if err != nil {
+		return err
+	}
+	if !positive(servings) {
+		return errors.New("Amount is too large")
+	}
+	entry.Quantity, entry.Amount, entry.Unit = servings, amount, unit
+	return nil
+}
+
+// servingFromEntry works out the per-serving nutrition an entry was
+// calculated from, for entries whose food version was never kept (they
+// were logged before foods had a history).
+func servingFromEntry(entry *models.Entry) (*models.Food, error) {
+	if entry.Quantity == 0 {
+		return nil, storage.ErrNotFound
 	}
 
-	http.Error(w, "Entry not found", http.StatusNotFound)
+	return &models.Food{
+		ID:       entry.FoodID,
+		Name:     entry.FoodName,
+		Version:  entry.FoodVersion,
+		Calories: entry.Calories / entry.Quantity,
+		Protein:  entry.Protein / entry.Quantity,
+		Carbs:    entry.Carbs / entry.Quantity,
+		Fats:     entry.Fats / entry.Quantity,
+
+		Micronutrients: entry.Micronutrients.Scale(1 / entry.Quantity),
+	}, nil
 }
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// etag formats a resource version as a strong entity tag.
+func etag(version int) string {
+	return `"` + strconv.Itoa(version) + `"`
+}
+
+// idETag tags a version of one of several resources a URL can resolve
+// to, so a client's tag stops matching when it resolves to another.
+func idETag(id string, version int) string {
+	return `"` + id + "-" + strconv.Itoa(version) + `"`
+}
+
+func setETag(w http.ResponseWriter, version int) {
+	w.Header().Set("ETag", etag(version))
+}
+
+// ifMatchFails reports whether the request carries an If-Match header that
+// doesn't match the current version. Requests without one always pass.
+func ifMatchFails(r *http.Request, version int) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return false
+	}
+	return !etagListMatches(header, etag(version), false)
+}
+
+// notModified writes a 304 and returns true if the request's If-None-Match
+// header matches the current version.
+func notModified(w http.ResponseWriter, r *http.Request, version int) bool {
+	return notModifiedTag(w, r, etag(version))
+}
+
+// notModifiedTag is notModified for an entity tag other than a plain
+// version.
+func notModifiedTag(w http.ResponseWriter, r *http.Request, current string) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" || !etagListMatches(header, current, true) {
+		return false
+	}
+
+	w.Header().Set("ETag", current)
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// etagListMatches checks a comma-separated list of entity tags, or "*",
+// against the current tag. Weak tags (W/"...") only match when weak is
+// true, as If-None-Match allows but If-Match does not.
+func etagListMatches(header, current string, weak bool) bool {
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+		if strings.HasPrefix(tag, "W/") {
+			if !weak {
+				continue
+			}
+			tag = tag[2:]
+		}
+		if tag == current {
+			return true
+		}
+	}
+	return false
+}
+
+func writePreconditionFailed(w http.ResponseWriter) {
+	http.Error(w, "Resource has been modified, fetch it again and retry", http.StatusPreconditionFailed)
+}
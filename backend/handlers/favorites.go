@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"myjunkpal/models"
+	"myjunkpal/storage"
+
+	"github.com/gorilla/mux"
+)
+
+// Recent and frequent foods list this many unless the request sets limit.
+const defaultUsageLimit = 20
+
+// An entry counts half as much toward a food's frequency after this long,
+// so last month's habits outrank last year's.
+const frequencyHalfLife = 30 * 24 * time.Hour
+
+// With meal_type or at, entries from other meals or far from that time
+// of day still count this much, so a food eaten at any meal can surface.
+const contextFloor = 0.2
+
+// Entries within about this long of the requested time of day count most.
+const timeOfDaySpread = 90 * time.Minute
+
+// AddFavorite marks a food the user can see as one of their favorites.
+// Marking it again changes nothing.
+func (h *FoodHandler) AddFavorite(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	food, err := h.foods.GetFood(id)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && food.UserID != "" && food.UserID != currentUser.ID) {
+		http.Error(w, "Food not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	fav := models.Favorite{UserID: currentUser.ID, FoodID: food.ID, CreatedAt: time.Now()}
+	if err := h.favorites.AddFavorite(fav); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RemoveFavorite unmarks a favorite food. Foods that aren't favorites are
+// left alone.
+func (h *FoodHandler) RemoveFavorite(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
+	vars := mux.Vars(r)
+	if err := h.favorites.RemoveFavorite(currentUser.ID, vars["id"]); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetFavorites lists the user's favorite foods, most recently marked
+// first. Archived foods are left out.
+func (h *FoodHandler) GetFavorites(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
+	entries, err := h.entries.EntriesForUser(currentUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	usage, err := h.foodUsage(currentUser.ID, entries)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	favorites, err := h.favorites.Favorites(currentUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	results := []models.FoodUsage{}
+	for _, fav := range favorites {
+		if u, ok := usage[fav.FoodID]; ok {
+			results = append(results, *u)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
+
+// GetRecentFoods lists the foods the user logged, most recently eaten
+// first.
+func (h *FoodHandler) GetRecentFoods(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
+	limit, offset, err := usagePageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	entries, err := h.entries.EntriesForUser(currentUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	usage, err := h.foodUsage(currentUser.ID, entries)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var results []models.FoodUsage
+	for _, u := range usage {
+		if u.Entries > 0 {
+			results = append(results, *u)
+		}
+	}
+	slices.SortFunc(results, func(a, b models.FoodUsage) int {
+		return cmp.Or(b.LastEatenAt.Compare(a.LastEatenAt), strings.Compare(a.ID, b.ID))
+	})
+
+	writeUsage(w, results, limit, offset)
+}
+
+// GetFrequentFoods lists the foods the user logs most, each entry counting
+// less the older it is. With meal_type, entries for that meal count more;
+// with at, a time of day, so do entries eaten around then, so breakfast
+// foods come first in the morning.
+func (h *FoodHandler) GetFrequentFoods(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
+	limit, offset, err := usagePageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mealType := r.URL.Query().Get("meal_type")
+	var clock time.Duration
+	at := r.URL.Query().Get("at")
+	if at != "" {
+		t, err := time.Parse("15:04", at)
+		if err != nil {
+			t, err = time.Parse(time.RFC3339, at)
+		}
+		if err != nil {
+			http.Error(w, "Invalid at, use a time of day like 07:30 or an ISO8601 time", http.StatusBadRequest)
+			return
+		}
+		clock = timeOfDay(t)
+	}
+
+	entries, err := h.entries.EntriesForUser(currentUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	usage, err := h.foodUsage(currentUser.ID, entries)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	for _, e := range entries {
+		u, ok := usage[e.FoodID]
+		if !ok {
+			continue
+		}
+
+		age := max(now.Sub(e.EatenAt), 0)
+		weight := math.Pow(0.5, float64(age)/float64(frequencyHalfLife))
+		if mealType != "" && !strings.EqualFold(e.MealType, mealType) {
+			weight *= contextFloor
+		}
+		if at != "" {
+			// Hours apart on the clock, wrapping at midnight
+			d := (timeOfDay(e.EatenAt) - clock).Abs()
+			d = min(d, 24*time.Hour-d)
+			closeness := math.Exp(-math.Pow(float64(d)/float64(timeOfDaySpread), 2) / 2)
+			weight *= contextFloor + (1-contextFloor)*closeness
+		}
+		u.Score += weight
+	}
+
+	var results []models.FoodUsage
+	for _, u := range usage {
+		if u.Entries > 0 {
+			u.Score = math.Round(u.Score*1000) / 1000
+			results = append(results, *u)
+		}
+	}
+	slices.SortFunc(results, func(a, b models.FoodUsage) int {
+		return cmp.Or(compareFloat(b.Score, a.Score), cmp.Compare(b.Entries, a.Entries), strings.Compare(a.ID, b.ID))
+	})
+
+	writeUsage(w, results, limit, offset)
+}
+
+// timeOfDay returns how far into its day t is, on its own clock.
+func timeOfDay(t time.Time) time.Duration {
+	h, m, s := t.Clock()
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+}
+
+// foodUsage returns the user's favorite and logged foods by ID, with how
+// the user's entries logged them, leaving out foods that are archived or
+// gone.
+func (h *FoodHandler) foodUsage(userID string, entries []models.Entry) (map[string]*models.FoodUsage, error) {
+	favorites, err := h.favorites.Favorites(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	usage := make(map[string]*models.FoodUsage)
+	get := func(foodID string) (*models.FoodUsage, error) {
+		if u, ok := usage[foodID]; ok {
+			return u, nil
+		}
+
+		food, err := h.foods.GetFood(foodID)
+		if errors.Is(err, storage.ErrNotFound) {
+			usage[foodID] = nil
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !food.ArchivedAt.IsZero() || (food.UserID != "" && food.UserID != userID) {
+			usage[foodID] = nil
+			return nil, nil
+		}
+
+		u := &models.FoodUsage{Food: *food}
+		usage[foodID] = u
+		return u, nil
+	}
+
+	for _, e := range entries {
+		u, err := get(e.FoodID)
+		if err != nil {
+			return nil, err
+		}
+		if u != nil {
+			u.Entries++
+			if e.EatenAt.After(u.LastEatenAt) {
+				u.LastEatenAt = e.EatenAt
+			}
+		}
+	}
+	for _, fav := range favorites {
+		u, err := get(fav.FoodID)
+		if err != nil {
+			return nil, err
+		}
+		if u != nil {
+			u.Favorite = true
+		}
+	}
+
+	maps.DeleteFunc(usage, func(_ string, u *models.FoodUsage) bool { return u == nil })
+	return usage, nil
+}
+
+// usagePageParams is pageParams with a default limit.
+func usagePageParams(r *http.Request) (limit, offset int, err error) {
+	limit, offset, err = pageParams(r)
+	if err == nil && r.URL.Query().Get("limit") == "" {
+		limit = defaultUsageLimit
+	}
+	return limit, offset, err
+}
+
+func writeUsage(w http.ResponseWriter, results []models.FoodUsage, limit, offset int) {
+	if results == nil {
+		results = []models.FoodUsage{}
+	}
+
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(results)))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(paginate(results, limit, offset))
+}
@@ -2,11 +2,19 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"net/http"
+	"slices"
+	"strconv"
 	"strings"
 	"time"
 
+	"myjunkpal/barcode"
+	"myjunkpal/categories"
 	"myjunkpal/models"
+	"myjunkpal/search"
 	"myjunkpal/storage"
 
 	"github.com/google/uuid"
@@ -14,81 +22,284 @@ import (
 )
 
 type FoodHandler struct {
-	store *storage.JSONStore
+	foods     storage.FoodRepo
+	entries   storage.EntryRepo
+	favorites storage.FavoriteRepo
 }
 
-func NewFoodHandler(store *storage.JSONStore) *FoodHandler {
-	return &FoodHandler{store: store}
+func NewFoodHandler(foods storage.FoodRepo, entries storage.EntryRepo, favorites storage.FavoriteRepo) *FoodHandler {
+	return &FoodHandler{foods: foods, entries: entries, favorites: favorites}
 }
 
+// GetFoods lists the foods the user can see. With name it searches them,
+// tolerating typos and partial words, and ranks the best matches first;
+// the user's own and most logged foods rank higher either way. Foods can
+// also be filtered by category, including its subcategories, tags, diets
+// and allergens to leave out.
 func (h *FoodHandler) GetFoods(w http.ResponseWriter, r *http.Request) {
-	var foods []models.Food
-	h.store.LoadFromFile("foods.json", &foods)
+	currentUser := UserFromContext(r.Context())
+
+	limit, offset, err := pageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// Only show system foods and user's custom foods
+	foods, err := h.foods.FoodsVisibleTo(currentUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	// Optional filters
 	name := r.URL.Query().Get("name")
 	category := r.URL.Query().Get("category")
 
-	// Filter foods
-	var filtered []models.Food
-	for _, f := range foods {
-		// Only show system foods and user's custom foods
-		if f.UserID != "" && f.UserID != CurrentUser.ID {
-			continue
+	if category != "" {
+		node, ok := categories.Lookup(category)
+		if !ok {
+			http.Error(w, fmt.Sprintf("Unknown category %q, see GET /api/categories", category), http.StatusBadRequest)
+			return
 		}
+		foods = slices.DeleteFunc(foods, func(f models.Food) bool {
+			return !node.Contains(f.Category)
+		})
+	}
 
-		if name != "" && !strings.Contains(strings.ToLower(f.Name), strings.ToLower(name)) {
-			continue
-		}
+	tags := listParam(r, "tag")
+	diets := listParam(r, "diet")
+	excluded := listParam(r, "exclude_allergens")
+	if err := errors.Join(checkLabels("diet", diets, models.Diets), checkLabels("allergen", excluded, models.Allergens)); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(tags)+len(diets)+len(excluded) > 0 {
+		foods = slices.DeleteFunc(foods, func(f models.Food) bool {
+			return !containsAll(f.Tags, tags) || !containsAll(f.Diets, diets) ||
+				slices.ContainsFunc(f.Allergens, func(a string) bool { return slices.Contains(excluded, a) })
+		})
+	}
 
-		if category != "" && !strings.EqualFold(f.Category, category) {
-			continue
+	logged, err := h.logCounts(currentUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var ix *search.Index
+	if name != "" {
+		if ix, err = h.foods.SearchIndex(); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
 		}
+	}
 
-		filtered = append(filtered, f)
+	results := rankFoods(ix, foods, name, currentUser.ID, logged)
+	if err := sortFoods(results, r.URL.Query().Get("sort")); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
+	w.Header().Set("X-Total-Count", strconv.Itoa(len(results)))
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(filtered)
+	json.NewEncoder(w).Encode(paginate(results, limit, offset))
+}
+
+// listParam collects a query parameter given as a comma separated list,
+// repeated, or both, normalized like food labels.
+func listParam(r *http.Request, name string) []string {
+	var values []string
+	for _, v := range r.URL.Query()[name] {
+		values = append(values, strings.Split(v, ",")...)
+	}
+	return normalizeLabels(values)
+}
+
+// containsAll reports whether have has every one of want.
+func containsAll(have, want []string) bool {
+	for _, w := range want {
+		if !slices.Contains(have, w) {
+			return false
+		}
+	}
+	return true
+}
+
+// logCounts counts the user's entries per food.
+func (h *FoodHandler) logCounts(userID string) (map[string]int, error) {
+	entries, err := h.entries.EntriesForUser(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	for _, e := range entries {
+		counts[e.FoodID]++
+	}
+	return counts, nil
 }
 
 func (h *FoodHandler) GetFood(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	var foods []models.Food
-	h.store.LoadFromFile("foods.json", &foods)
+	food, err := h.foods.GetFood(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Food not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	for _, f := range foods {
-		if f.ID == id {
-			// Check if user has access
-			if f.UserID != "" && f.UserID != CurrentUser.ID {
-				http.Error(w, "Food not found", http.StatusNotFound)
-				return
-			}
+	// Check if user has access
+	if food.UserID != "" && food.UserID != currentUser.ID {
+		http.Error(w, "Food not found", http.StatusNotFound)
+		return
+	}
+
+	if notModified(w, r, food.Version) {
+		return
+	}
+
+	setETag(w, food.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(food)
+}
 
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(f)
+// GetFoodByBarcode looks up a scanned EAN-13 or UPC-A code, preferring
+// the user's own food for it over a system food. Unknown codes give 404;
+// creating a food with the barcode makes the next scan find it.
+func (h *FoodHandler) GetFoodByBarcode(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
+	vars := mux.Vars(r)
+	code, err := barcode.Normalize(vars["code"])
+	if err != nil {
+		http.Error(w, "Invalid barcode: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	foods, err := h.foods.FoodsWithBarcode(code, currentUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(foods) == 0 {
+		http.Error(w, fmt.Sprintf("No food with barcode %s, create one with POST /api/foods and \"barcode\": %q", code, code), http.StatusNotFound)
+		return
+	}
+	food := foods[0]
+
+	// The code can come to find another food, e.g. a custom one with the
+	// same barcode, so the tag names the food as well as its version
+	tag := idETag(food.ID, food.Version)
+	if notModifiedTag(w, r, tag) {
+		return
+	}
+
+	w.Header().Set("ETag", tag)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(food)
+}
+
+// GetFoodHistory lists every version of a food, newest first, starting
+// with the current one.
+func (h *FoodHandler) GetFoodHistory(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	food, err := h.foods.GetFood(id)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && food.UserID != "" && food.UserID != currentUser.ID) {
+		http.Error(w, "Food not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	past, err := h.foods.FoodHistory(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	history := []models.FoodRevision{{Food: *food}}
+	for i := len(past) - 1; i >= 0; i-- {
+		history = append(history, past[i])
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(history)
+}
+
+// ReapplyFood recalculates the current user's entries for a food from its
+// latest version. Entries otherwise keep the version they were logged
+// against, so this is how a correction to a food is carried back.
+func (h *FoodHandler) ReapplyFood(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	food, err := h.foods.GetFood(id)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && food.UserID != "" && food.UserID != currentUser.ID) {
+		http.Error(w, "Food not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	entries, err := h.entries.EntriesForUser(currentUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := models.ReapplyFoodResponse{FoodID: food.ID, Version: food.Version}
+	for _, entry := range entries {
+		if entry.FoodID != food.ID || entry.FoodVersion == food.Version {
+			continue
+		}
+
+		applyFood(&entry, food)
+		err := h.entries.UpdateEntry(entry)
+		if errors.Is(err, storage.ErrVersionConflict) || errors.Is(err, storage.ErrNotFound) {
+			resp.Skipped++
+			continue
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		resp.Updated++
 	}
 
-	http.Error(w, "Food not found", http.StatusNotFound)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
 }
 
 func (h *FoodHandler) CreateFood(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
 	var req models.CreateFoodRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	var foods []models.Food
-	h.store.LoadFromFile("foods.json", &foods)
-
 	food := models.Food{
 		ID:          uuid.New().String(),
-		UserID:      CurrentUser.ID,
+		UserID:      currentUser.ID,
 		Name:        req.Name,
 		Calories:    req.Calories,
 		Protein:     req.Protein,
@@ -97,22 +308,44 @@ func (h *FoodHandler) CreateFood(w http.ResponseWriter, r *http.Request) {
 		ServingSize: req.ServingSize,
 		ServingUnit: req.ServingUnit,
 		Category:    req.Category,
+		Density:     req.Density,
+		Portions:    req.Portions,
+		Barcode:     req.Barcode,
+		Tags:        req.Tags,
+		Allergens:   req.Allergens,
+		Diets:       req.Diets,
+		Version:     1,
 		CreatedAt:   time.Now(),
+
+		Micronutrients: req.Micronutrients,
 	}
 
-	foods = append(foods, food)
+	errs, warnings := validateFood(&food)
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
 
-	if err := h.store.SaveToFile("foods.json", foods); err != nil {
+	code, ok := h.checkBarcode(w, food.Barcode, currentUser.ID, "")
+	if !ok {
+		return
+	}
+	food.Barcode = code
+
+	if err := h.foods.CreateFood(food); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
+	setETag(w, food.Version)
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(food)
+	json.NewEncoder(w).Encode(models.FoodResponse{Food: food, Warnings: warnings})
 }
 
 func (h *FoodHandler) UpdateFood(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
 	vars := mux.Vars(r)
 	id := vars["id"]
 
@@ -122,68 +355,341 @@ func (h *FoodHandler) UpdateFood(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var foods []models.Food
-	h.store.LoadFromFile("foods.json", &foods)
+	food, err := h.foods.GetFood(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Food not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Check if user owns this food
+	if food.UserID != currentUser.ID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
 
-	for i, f := range foods {
-		if f.ID == id {
-			// Check if user owns this food
-			if f.UserID != CurrentUser.ID {
-				http.Error(w, "Forbidden", http.StatusForbidden)
-				return
-			}
+	if food.IsRecipe() {
+		http.Error(w, "Recipes are edited with PUT /api/recipes/{id}", http.StatusBadRequest)
+		return
+	}
 
-			// Update fields
-			foods[i].Name = req.Name
-			foods[i].Calories = req.Calories
-			foods[i].Protein = req.Protein
-			foods[i].Carbs = req.Carbs
-			foods[i].Fats = req.Fats
-			foods[i].ServingSize = req.ServingSize
-			foods[i].ServingUnit = req.ServingUnit
-			foods[i].Category = req.Category
-
-			if err := h.store.SaveToFile("foods.json", foods); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+	if ifMatchFails(r, food.Version) {
+		writePreconditionFailed(w)
+		return
+	}
 
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(foods[i])
-			return
-		}
+	// Update fields
+	food.Name = req.Name
+	food.Calories = req.Calories
+	food.Protein = req.Protein
+	food.Carbs = req.Carbs
+	food.Fats = req.Fats
+	food.ServingSize = req.ServingSize
+	food.ServingUnit = req.ServingUnit
+	food.Category = req.Category
+	food.Density = req.Density
+	food.Portions = req.Portions
+	food.Micronutrients = req.Micronutrients
+	food.Barcode = req.Barcode
+	food.Tags = req.Tags
+	food.Allergens = req.Allergens
+	food.Diets = req.Diets
+
+	errs, warnings := validateFood(food)
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	code, ok := h.checkBarcode(w, food.Barcode, currentUser.ID, food.ID)
+	if !ok {
+		return
+	}
+	food.Barcode = code
+
+	err = h.foods.UpdateFood(*food)
+	if errors.Is(err, storage.ErrVersionConflict) {
+		writePreconditionFailed(w)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	food.Version++
 
-	http.Error(w, "Food not found", http.StatusNotFound)
+	refreshRecipesUsing(h.foods, food.ID)
+
+	setETag(w, food.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.FoodResponse{Food: *food, Warnings: warnings})
 }
 
+// checkBarcode normalizes a barcode sent for a food, which must not be on
+// another of the user's foods, writing the error response if it fails.
+// An empty barcode is fine.
+func (h *FoodHandler) checkBarcode(w http.ResponseWriter, code, userID, foodID string) (string, bool) {
+	if code == "" {
+		return "", true
+	}
+
+	code, err := barcode.Normalize(code)
+	if err != nil {
+		http.Error(w, "Invalid barcode: "+err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+
+	foods, err := h.foods.FoodsWithBarcode(code, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return "", false
+	}
+	for _, f := range foods {
+		if f.UserID == userID && f.ID != foodID {
+			http.Error(w, fmt.Sprintf("Your food %s already has barcode %s", f.Name, code), http.StatusConflict)
+			return "", false
+		}
+	}
+	return code, true
+}
+
+// DeleteFood archives a food: it disappears from listings but entries and
+// lookups by ID keep working. With ?hard=true it is removed for good,
+// failing with 409 while entries reference it; ?cascade=reassign&to=<id>
+// first moves those entries onto the replacement food.
 func (h *FoodHandler) DeleteFood(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
 	vars := mux.Vars(r)
 	id := vars["id"]
 
-	var foods []models.Food
-	h.store.LoadFromFile("foods.json", &foods)
+	food, err := h.foods.GetFood(id)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "Food not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	for i, f := range foods {
-		if f.ID == id {
-			// Check if user owns this food
-			if f.UserID != CurrentUser.ID {
-				http.Error(w, "Forbidden", http.StatusForbidden)
-				return
-			}
+	// Check if user owns this food
+	if food.UserID != currentUser.ID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
 
-			// Remove from slice
-			foods = append(foods[:i], foods[i+1:]...)
+	if ifMatchFails(r, food.Version) {
+		writePreconditionFailed(w)
+		return
+	}
 
-			if err := h.store.SaveToFile("foods.json", foods); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
+	query := r.URL.Query()
+	switch cascade := query.Get("cascade"); {
+	case cascade == "reassign":
+		h.reassignAndDelete(w, currentUser.ID, food, query.Get("to"))
+	case cascade != "":
+		http.Error(w, "Invalid cascade, use cascade=reassign&to=<foodID>", http.StatusBadRequest)
+	case query.Get("hard") == "true":
+		h.hardDelete(w, food)
+	default:
+		err := h.archive(food)
+		if errors.Is(err, storage.ErrVersionConflict) {
+			writePreconditionFailed(w)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// archive marks food as archived unless it already is.
+func (h *FoodHandler) archive(food *models.Food) error {
+	if !food.ArchivedAt.IsZero() {
+		return nil
+	}
+
+	food.ArchivedAt = time.Now()
+	if err := h.foods.UpdateFood(*food); err != nil {
+		return err
+	}
+	food.Version++
+	return nil
+}
+
+func (h *FoodHandler) hardDelete(w http.ResponseWriter, food *models.Food) {
+	err := h.deleteFood(food)
+	if errors.Is(err, storage.ErrInUse) {
+		h.writeFoodInUse(w, food.ID)
+		return
+	}
+	if errors.Is(err, storage.ErrVersionConflict) {
+		writePreconditionFailed(w)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteFood permanently deletes the owner's custom food and their
+// favorite of it.
+func (h *FoodHandler) deleteFood(food *models.Food) error {
+	if err := h.foods.DeleteFood(food.ID, food.Version); err != nil {
+		return err
+	}
+
+	if err := h.favorites.RemoveFavorite(food.UserID, food.ID); err != nil {
+		log.Printf("Warning: failed to remove favorite of deleted food %s: %v", food.ID, err)
+	}
+	return nil
+}
+
+// reassignAndDelete moves every entry and recipe ingredient for food onto
+// the food with ID toID, recalculating them from its current version, then
+// hard deletes food.
+func (h *FoodHandler) reassignAndDelete(w http.ResponseWriter, userID string, food *models.Food, toID string) {
+	if toID == "" || toID == food.ID {
+		http.Error(w, "cascade=reassign needs a different food in to", http.StatusBadRequest)
+		return
+	}
+
+	target, err := h.foods.GetFood(toID)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && (target.UserID != "" && target.UserID != userID || !target.ArchivedAt.IsZero())) {
+		http.Error(w, "Replacement food not found", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	_, _, err = h.replace(food, target)
+	if errors.Is(err, storage.ErrInUse) {
+		h.writeFoodInUse(w, food.ID)
+		return
+	}
+	if errors.Is(err, storage.ErrVersionConflict) {
+		writePreconditionFailed(w)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// replace archives food, moves its recipe ingredients and then its
+// entries onto target, converting their amounts to target's servings
+// where the units allow and recalculating them, and deletes food. It
+// returns how many of each moved. It returns ErrVersionConflict if food
+// changed since it was read, and ErrInUse, leaving food archived, if a
+// recipe couldn't take target.
+func (h *FoodHandler) replace(food, target *models.Food) (entries, recipes int, err error) {
+	// Archive first so no new recipes use the food while the existing
+	// ones are moved
+	if err := h.archive(food); err != nil {
+		return 0, 0, err
+	}
+
+	// The owner's favorite follows the food too
+	favorites, err := h.favorites.Favorites(food.UserID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if slices.ContainsFunc(favorites, func(f models.Favorite) bool { return f.FoodID == food.ID }) {
+		fav := models.Favorite{UserID: food.UserID, FoodID: target.ID, CreatedAt: time.Now()}
+		if err := h.favorites.AddFavorite(fav); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	using, err := h.foods.RecipesUsing(food.ID)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, recipe := range using {
+		for i := range recipe.Ingredients {
+			if ing := &recipe.Ingredients[i]; ing.FoodID == food.ID {
+				ing.FoodID = target.ID
+				if servings, ok := convertServings(ing.Quantity, food, target); ok {
+					ing.Quantity = servings
+				}
 			}
+		}
 
-			w.WriteHeader(http.StatusNoContent)
-			return
+		// Recipes that can't take the replacement (it would contain
+		// itself) keep the old food, and deleting it fails with ErrInUse
+		err := buildRecipe(h.foods, &recipe)
+		var invalid *recipeError
+		if errors.As(err, &invalid) {
+			continue
+		}
+		if err == nil {
+			err = h.foods.UpdateFood(recipe)
+		}
+		if err != nil && !errors.Is(err, storage.ErrVersionConflict) && !errors.Is(err, storage.ErrNotFound) {
+			return 0, recipes, err
+		}
+		if err == nil {
+			recipes++
+			refreshRecipesUsing(h.foods, recipe.ID)
 		}
 	}
 
-	http.Error(w, "Food not found", http.StatusNotFound)
+	// Entries move in the transaction deleting the food, so one logged
+	// meanwhile can't be left pointing at it
+	entries, err = h.foods.ReplaceFood(food.ID, food.Version, func(entry *models.Entry) {
+		moveEntry(entry, food, target)
+	})
+	if err != nil {
+		return 0, recipes, err
+	}
+
+	if err := h.favorites.RemoveFavorite(food.UserID, food.ID); err != nil {
+		log.Printf("Warning: failed to remove favorite of deleted food %s: %v", food.ID, err)
+	}
+	return entries, recipes, nil
+}
+
+func (h *FoodHandler) writeFoodInUse(w http.ResponseWriter, foodID string) {
+	entries, err := h.entries.EntriesForFood(foodID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	recipes, err := h.foods.RecipesUsing(foodID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	users := make(map[string]bool)
+	for _, e := range entries {
+		users[e.UserID] = true
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(models.FoodInUseResponse{
+		Error:   "Food is referenced by entries or recipes, archive it or reassign them with cascade=reassign",
+		FoodID:  foodID,
+		Entries: len(entries),
+		Recipes: len(recipes),
+		Users:   len(users),
+	})
 }
@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"myjunkpal/models"
+	"myjunkpal/units"
+)
+
+const (
+	// A line's best match must score this much to be used
+	matchThreshold = 0.6
+	// Weaker matches down to this score are offered as candidates
+	candidateThreshold = 0.4
+	maxCandidates      = 3
+)
+
+// ParseIngredients matches each line of a pasted ingredient list against
+// the foods visible to the user and sums their nutrition, so the list can
+// be saved as one custom food with CreateFood.
+func (h *FoodHandler) ParseIngredients(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
+	var req models.ParseIngredientsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	foods, err := h.foods.FoodsVisibleTo(currentUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := models.ParseIngredientsResponse{
+		Ingredients: []models.ParsedIngredient{},
+		Food: models.CreateFoodRequest{
+			Name:        req.Name,
+			ServingSize: 1,
+			ServingUnit: "serving",
+		},
+	}
+
+	for _, line := range strings.Split(req.Text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+
+		ing := matchIngredient(line, foods)
+		if ing.Matched {
+			resp.Food.Calories += ing.Calories
+			resp.Food.Protein += ing.Protein
+			resp.Food.Carbs += ing.Carbs
+			resp.Food.Fats += ing.Fats
+			resp.Food.Micronutrients = resp.Food.Micronutrients.Add(ing.Micronutrients)
+		} else {
+			resp.Unmatched++
+		}
+		resp.Ingredients = append(resp.Ingredients, ing)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func matchIngredient(line string, foods []models.Food) models.ParsedIngredient {
+	parsed := parseIngredientLine(line)
+	ing := models.ParsedIngredient{
+		Line:     strings.TrimSpace(line),
+		Quantity: parsed.quantity,
+		Unit:     parsed.unit,
+		Name:     parsed.name,
+	}
+	if ing.Name == "" {
+		ing.Problem = "No ingredient name found"
+		return ing
+	}
+
+	matches := bestMatches(ing.Name, foods, candidateThreshold, maxCandidates+1)
+
+	// Without a unit the first word may name one of the food's portions,
+	// as in "2 slices bread" or "3 large eggs"
+	if first, rest, ok := strings.Cut(ing.Name, " "); ok && ing.Unit == "" {
+		portioned := bestMatches(rest, foods, candidateThreshold, maxCandidates+1)
+		if len(portioned) > 0 && portioned[0].score >= matchThreshold &&
+			converterFor(&portioned[0].food).HasPortion(first) {
+			ing.Unit = first
+			ing.Name = rest
+			matches = portioned
+		}
+	}
+
+	if len(matches) == 0 || matches[0].score < matchThreshold {
+		ing.Problem = "No matching food"
+		ing.Candidates = foodMatches(matches)
+		return ing
+	}
+
+	food := matches[0].food
+	ing.Food = &food
+	ing.Confidence = matches[0].score
+	ing.Candidates = foodMatches(matches[1:])
+
+	servings, err := servingsFor(&food, ing.Quantity, ing.Unit)
+	if err != nil {
+		ing.Problem = err.Error()
+		return ing
+	}
+	if !positive(servings) {
+		ing.Problem = "Quantity is too large"
+		return ing
+	}
+
+	ing.Matched = true
+	ing.Servings = servings
+	ing.Calories = food.Calories * servings
+	ing.Protein = food.Protein * servings
+	ing.Carbs = food.Carbs * servings
+	ing.Fats = food.Fats * servings
+	ing.Micronutrients = food.Micronutrients.Scale(servings)
+	return ing
+}
+
+func foodMatches(matches []foodMatch) []models.FoodMatch {
+	var out []models.FoodMatch
+	for _, m := range matches {
+		out = append(out, models.FoodMatch{FoodID: m.food.ID, Name: m.food.Name, Confidence: m.score})
+	}
+	return out
+}
+
+type ingredientLine struct {
+	quantity float64
+	unit     string // Canonical unit name, empty for servings or a portion
+	name     string
+}
+
+var (
+	// A number with a unit stuck to it, like "200g" or "1.5kg"
+	attachedUnit = regexp.MustCompile(`^([0-9.,/½⅓⅔¼¾⅛]+)(\pL.*)$`)
+	// A list marker such as "-", "*" or "•"
+	listMarker = regexp.MustCompile(`^[-*•·]+\s*`)
+	// Parenthesised notes such as "(about 2)"
+	parenthetical = regexp.MustCompile(`\([^)]*\)`)
+)
+
+// parseIngredientLine splits a line like "1 1/2 cups white rice, cooked"
+// into quantity, unit and ingredient name. Lines without a quantity mean
+// one serving; lines without a known unit give a number of servings.
+func parseIngredientLine(line string) ingredientLine {
+	line = strings.TrimSpace(line)
+	line = listMarker.ReplaceAllString(line, "")
+	line = parenthetical.ReplaceAllString(line, " ")
+	// Whatever follows a comma describes preparation, not the food
+	if i := strings.Index(line, ","); i >= 0 && !startsWithNumber(line[i+1:]) {
+		line = line[:i]
+	}
+
+	var tokens []string
+	for _, t := range strings.Fields(line) {
+		if m := attachedUnit.FindStringSubmatch(t); m != nil && len(tokens) == 0 {
+			tokens = append(tokens, m[1], m[2])
+			continue
+		}
+		tokens = append(tokens, t)
+	}
+
+	parsed := ingredientLine{quantity: 1}
+	n := 0
+	if len(tokens) > 0 {
+		if q, ok := parseQuantity(tokens[0]); ok {
+			parsed.quantity = q
+			n = 1
+			// Mixed numbers: "1 1/2"
+			if len(tokens) > 1 && (strings.Contains(tokens[1], "/") || isVulgarFraction(tokens[1])) {
+				if frac, ok := parseQuantity(tokens[1]); ok && frac < 1 {
+					parsed.quantity += frac
+					n = 2
+				}
+			}
+		}
+	}
+
+	// A unit follows the quantity and can be two words ("fl oz") or one
+	if n > 0 && n+1 < len(tokens) {
+		if u, ok := units.Lookup(tokens[n] + " " + tokens[n+1]); ok {
+			parsed.unit = u.Name
+			n += 2
+		}
+	}
+	if n > 0 && parsed.unit == "" && n < len(tokens) {
+		if u, ok := units.Lookup(tokens[n]); ok {
+			parsed.unit = u.Name
+			n++
+		}
+	}
+
+	rest := tokens[n:]
+	if len(rest) > 0 && strings.EqualFold(rest[0], "of") {
+		rest = rest[1:]
+	}
+	parsed.name = strings.Join(rest, " ")
+	return parsed
+}
+
+var vulgarFractions = map[rune]float64{
+	'½': 1.0 / 2, '⅓': 1.0 / 3, '⅔': 2.0 / 3, '¼': 1.0 / 4, '¾': 3.0 / 4, '⅛': 1.0 / 8,
+}
+
+func isVulgarFraction(s string) bool {
+	r := []rune(s)
+	if len(r) != 1 {
+		return false
+	}
+	_, ok := vulgarFractions[r[0]]
+	return ok
+}
+
+func startsWithNumber(s string) bool {
+	s = strings.TrimSpace(s)
+	return s != "" && s[0] >= '0' && s[0] <= '9'
+}
+
+// parseQuantity parses "2", "1.5", "1,5", "1/2", "½", "1½" or a range
+// such as "2-3", which counts as its midpoint. Only positive, finite
+// quantities parse.
+func parseQuantity(s string) (float64, bool) {
+	q, ok := parseNumber(s)
+	if !ok || !positive(q) {
+		return 0, false
+	}
+	return q, true
+}
+
+func parseNumber(s string) (float64, bool) {
+	if lo, hi, ok := strings.Cut(s, "-"); ok {
+		a, okA := parseQuantity(lo)
+		b, okB := parseQuantity(hi)
+		return (a + b) / 2, okA && okB
+	}
+
+	if num, den, ok := strings.Cut(s, "/"); ok {
+		a, errA := strconv.ParseFloat(num, 64)
+		b, errB := strconv.ParseFloat(den, 64)
+		if errA != nil || errB != nil || b == 0 {
+			return 0, false
+		}
+		return a / b, true
+	}
+
+	r := []rune(s)
+	if len(r) > 0 {
+		if frac, ok := vulgarFractions[r[len(r)-1]]; ok {
+			if len(r) == 1 {
+				return frac, true
+			}
+			whole, err := strconv.ParseFloat(string(r[:len(r)-1]), 64)
+			return whole + frac, err == nil
+		}
+	}
+
+	q, err := strconv.ParseFloat(strings.Replace(s, ",", ".", 1), 64)
+	return q, err == nil
+}
+
+// positive reports whether x is a usable amount: more than zero and
+// neither infinite nor NaN.
+func positive(x float64) bool {
+	return x > 0 && !math.IsInf(x, 0)
+}
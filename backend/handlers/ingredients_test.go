@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"math"
+	"testing"
+
+	"myjunkpal/models"
+)
+
+func TestParseIngredientLine(t *testing.T) {
+	tests := []struct {
+		line string
+		want ingredientLine
+	}{
+		{"2 eggs", ingredientLine{2, "", "eggs"}},
+		{"eggs", ingredientLine{1, "", "eggs"}},
+		{"200g chicken breast", ingredientLine{200, "g", "chicken breast"}},
+		{"1.5 kg potatoes", ingredientLine{1.5, "kg", "potatoes"}},
+		{"1,5 kg potatoes", ingredientLine{1.5, "kg", "potatoes"}},
+		{"1 1/2 cups white rice, cooked", ingredientLine{1.5, "cup", "white rice"}},
+		{"½ cup milk", ingredientLine{0.5, "cup", "milk"}},
+		{"1½ cups flour", ingredientLine{1.5, "cup", "flour"}},
+		{"2-3 tbsp olive oil", ingredientLine{2.5, "tbsp", "olive oil"}},
+		{"8 fl oz orange juice", ingredientLine{8, "fl oz", "orange juice"}},
+		{"2 Tbsp. of honey", ingredientLine{2, "tbsp", "honey"}},
+		{"- 3 large eggs (about 150 g)", ingredientLine{3, "", "large eggs"}},
+		{"• 100 grams oats", ingredientLine{100, "g", "oats"}},
+		{"salt, to taste", ingredientLine{1, "", "salt"}},
+		{"2 slices bread", ingredientLine{2, "", "slices bread"}},
+		{"0 g sugar", ingredientLine{1, "", "0 g sugar"}},
+		{"", ingredientLine{1, "", ""}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			got := parseIngredientLine(tt.line)
+			if got.unit != tt.want.unit || got.name != tt.want.name || math.Abs(got.quantity-tt.want.quantity) > 1e-9 {
+				t.Errorf("parseIngredientLine(%q) = %+v, want %+v", tt.line, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseQuantity(t *testing.T) {
+	tests := []struct {
+		s      string
+		want   float64
+		wantOK bool
+	}{
+		{"2", 2, true},
+		{"1.5", 1.5, true},
+		{"1,5", 1.5, true},
+		{"1/2", 0.5, true},
+		{"⅓", 1.0 / 3, true},
+		{"2¼", 2.25, true},
+		{"2-3", 2.5, true},
+		{"0", 0, false},
+		{"-1", 0, false},
+		{"1/0", 0, false},
+		{"NaN", 0, false},
+		{"Inf", 0, false},
+		{"1e400", 0, false},
+		{"a", 0, false},
+		{"", 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, ok := parseQuantity(tt.s)
+			if ok != tt.wantOK || math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("parseQuantity(%q) = %g, %v, want %g, %v", tt.s, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestMatchIngredient(t *testing.T) {
+	foods := []models.Food{
+		{ID: "rice", Name: "White Rice", Calories: 130, ServingSize: 100, ServingUnit: "g"},
+		{ID: "brown", Name: "Brown Rice", Calories: 112, ServingSize: 100, ServingUnit: "g"},
+		{ID: "bread", Name: "Whole Wheat Bread", Calories: 80, ServingSize: 1, ServingUnit: "slice",
+			Portions: []models.Portion{{Name: "slice", Amount: 28, Unit: "g"}}},
+		{ID: "milk", Name: "Milk", Calories: 42, ServingSize: 100, ServingUnit: "ml"},
+	}
+
+	tests := []struct {
+		line     string
+		wantID   string
+		servings float64
+		problem  bool
+	}{
+		{"200 g white rice", "rice", 2, false},
+		{"50g brown rice, rinsed", "brown", 0.5, false},
+		{"2 slices whole wheat bread", "bread", 2, false},
+		{"250 ml milk", "milk", 2.5, false},
+		{"1 cup white rice", "rice", 0, true}, // No density to weigh a cup
+		{"3 tbsp unicorn dust", "", 0, true},
+		{"2 cups", "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.line, func(t *testing.T) {
+			ing := matchIngredient(tt.line, foods)
+			if (ing.Problem != "") != tt.problem {
+				t.Fatalf("matchIngredient(%q) problem = %q, want one: %v", tt.line, ing.Problem, tt.problem)
+			}
+			if tt.wantID == "" {
+				if ing.Food != nil && ing.Matched {
+					t.Errorf("matchIngredient(%q) matched %s, want no match", tt.line, ing.Food.ID)
+				}
+				return
+			}
+			if ing.Food == nil || ing.Food.ID != tt.wantID {
+				t.Fatalf("matchIngredient(%q) food = %+v, want %s", tt.line, ing.Food, tt.wantID)
+			}
+			if !tt.problem && math.Abs(ing.Servings-tt.servings) > 1e-9 {
+				t.Errorf("matchIngredient(%q) servings = %g, want %g", tt.line, ing.Servings, tt.servings)
+			}
+		})
+	}
+}
@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"myjunkpal/models"
+	"myjunkpal/search"
+)
+
+type foodMatch struct {
+	food  models.Food
+	score float64
+}
+
+// bestMatches scores every food against query and returns up to limit
+// matches scoring at least minScore, best first. Ties keep catalog order.
+func bestMatches(query string, foods []models.Food, minScore float64, limit int) []foodMatch {
+	q := search.Tokens(query)
+
+	var matches []foodMatch
+	for _, f := range foods {
+		score := search.Score(q, search.Tokens(f.Name))
+		if score < minScore {
+			continue
+		}
+
+		// Insertion keeps the list sorted and short
+		i := len(matches)
+		for i > 0 && matches[i-1].score < score {
+			i--
+		}
+		if i >= limit {
+			continue
+		}
+		matches = append(matches, foodMatch{})
+		copy(matches[i+1:], matches[i:])
+		matches[i] = foodMatch{food: f, score: score}
+		if len(matches) > limit {
+			matches = matches[:limit]
+		}
+	}
+	return matches
+}
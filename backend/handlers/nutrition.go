@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"math"
 	"net/http"
 	"time"
 
+	"myjunkpal/intake"
 	"myjunkpal/models"
 	"myjunkpal/storage"
 
@@ -12,14 +15,17 @@ import (
 )
 
 type NutritionHandler struct {
-	store *storage.JSONStore
+	entries storage.EntryRepo
+	goals   storage.GoalRepo
 }
 
-func NewNutritionHandler(store *storage.JSONStore) *NutritionHandler {
-	return &NutritionHandler{store: store}
+func NewNutritionHandler(entries storage.EntryRepo, goals storage.GoalRepo) *NutritionHandler {
+	return &NutritionHandler{entries: entries, goals: goals}
 }
 
 func (h *NutritionHandler) GetDailySummary(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
 	vars := mux.Vars(r)
 	dateStr := vars["date"]
 
@@ -30,19 +36,20 @@ func (h *NutritionHandler) GetDailySummary(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	// Load entries
-	var entries []models.Entry
-	h.store.LoadFromFile("entries.json", &entries)
+	// Load entries around this date. Entries keep the offset they were
+	// logged with, so widen by a day each side and match on calendar day.
+	entries, err := h.entries.EntriesForUserInRange(currentUser.ID, date.Add(-24*time.Hour), date.Add(48*time.Hour))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	// Filter entries for this date and user
+	// Filter entries for this date
 	var dayEntries []models.Entry
 	var totalCalories, totalProtein, totalCarbs, totalFats float64
+	var totalMicros models.Micronutrients
 
 	for _, e := range entries {
-		if e.UserID != CurrentUser.ID {
-			continue
-		}
-
 		// Check if entry is on the same day
 		if e.EatenAt.Year() == date.Year() &&
 			e.EatenAt.Month() == date.Month() &&
@@ -52,6 +59,7 @@ func (h *NutritionHandler) GetDailySummary(w http.ResponseWriter, r *http.Reques
 			totalProtein += e.Protein
 			totalCarbs += e.Carbs
 			totalFats += e.Fats
+			totalMicros = totalMicros.Add(e.Micronutrients)
 		}
 	}
 
@@ -62,13 +70,24 @@ func (h *NutritionHandler) GetDailySummary(w http.ResponseWriter, r *http.Reques
 		Carbs:    totalCarbs,
 		Fats:     totalFats,
 		Entries:  dayEntries,
+
+		Micronutrients: totalMicros,
+	}
+
+	goals, err := h.goals.GetGoals(currentUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	summary.Progress = progress(&summary, goals)
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(summary)
 }
 
 func (h *NutritionHandler) GetWeeklySummary(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
 	// Get start date from query param, default to today
 	startDateStr := r.URL.Query().Get("start_date")
 	var startDate time.Time
@@ -88,8 +107,11 @@ func (h *NutritionHandler) GetWeeklySummary(w http.ResponseWriter, r *http.Reque
 	endDate := startDate.Add(-7 * 24 * time.Hour)
 
 	// Load entries
-	var entries []models.Entry
-	h.store.LoadFromFile("entries.json", &entries)
+	entries, err := h.entries.EntriesForUserInRange(currentUser.ID, endDate, startDate.Add(24*time.Hour))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
 	// Create a map to store daily summaries
 	dailySummaries := make(map[string]*models.NutritionSummary)
@@ -106,17 +128,14 @@ func (h *NutritionHandler) GetWeeklySummary(w http.ResponseWriter, r *http.Reque
 
 	// Aggregate entries
 	for _, e := range entries {
-		if e.UserID != CurrentUser.ID {
-			continue
-		}
-
-		if e.EatenAt.After(endDate) && e.EatenAt.Before(startDate.Add(24*time.Hour)) {
+		if e.EatenAt.After(endDate) {
 			dateStr := e.EatenAt.Format("2006-01-02")
 			if summary, exists := dailySummaries[dateStr]; exists {
 				summary.Calories += e.Calories
 				summary.Protein += e.Protein
 				summary.Carbs += e.Carbs
 				summary.Fats += e.Fats
+				summary.Micronutrients = summary.Micronutrients.Add(e.Micronutrients)
 				summary.Entries = append(summary.Entries, e)
 			}
 		}
@@ -133,52 +152,88 @@ func (h *NutritionHandler) GetWeeklySummary(w http.ResponseWriter, r *http.Reque
 }
 
 func (h *NutritionHandler) GetGoals(w http.ResponseWriter, r *http.Request) {
-	goals := models.NutritionGoals{
-		DailyCalorieGoal: CurrentUser.DailyCalorieGoal,
-		DailyProteinGoal: CurrentUser.DailyProteinGoal,
-		DailyCarbsGoal:   CurrentUser.DailyCarbsGoal,
-		DailyFatsGoal:    CurrentUser.DailyFatsGoal,
+	currentUser := UserFromContext(r.Context())
+
+	goals, err := h.goals.GetGoals(currentUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(goals)
 }
 
+// GetDefaultGoals returns the reference goals for the current user's
+// profile, without saving them.
+func (h *NutritionHandler) GetDefaultGoals(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
+	goals := intake.Goals(currentUser.Age, currentUser.Sex, currentUser.Weight)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(goals)
+}
+
 func (h *NutritionHandler) UpdateGoals(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
 	var goals models.NutritionGoals
 	if err := json.NewDecoder(r.Body).Decode(&goals); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Load users
-	var users []models.User
-	h.store.LoadFromFile("users.json", &users)
-
 	// Update current user's goals
-	for i, u := range users {
-		if u.ID == CurrentUser.ID {
-			users[i].DailyCalorieGoal = goals.DailyCalorieGoal
-			users[i].DailyProteinGoal = goals.DailyProteinGoal
-			users[i].DailyCarbsGoal = goals.DailyCarbsGoal
-			users[i].DailyFatsGoal = goals.DailyFatsGoal
-
-			if err := h.store.SaveToFile("users.json", users); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-				return
-			}
+	err := h.goals.UpdateGoals(currentUser.ID, goals)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-			// Update in-memory user
-			CurrentUser.DailyCalorieGoal = goals.DailyCalorieGoal
-			CurrentUser.DailyProteinGoal = goals.DailyProteinGoal
-			CurrentUser.DailyCarbsGoal = goals.DailyCarbsGoal
-			CurrentUser.DailyFatsGoal = goals.DailyFatsGoal
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(goals)
+}
 
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(goals)
-			return
-		}
+// progress compares a day's totals with the goals that are set.
+func progress(summary *models.NutritionSummary, goals models.NutritionGoals) map[string]models.NutrientProgress {
+	nutrients := []struct {
+		name          string
+		amount        float64
+		target, limit float64
+	}{
+		{"calories", summary.Calories, goals.DailyCalorieGoal, 0},
+		{"protein", summary.Protein, goals.DailyProteinGoal, 0},
+		{"carbs", summary.Carbs, goals.DailyCarbsGoal, 0},
+		{"fats", summary.Fats, goals.DailyFatsGoal, 0},
+		{"fiber", summary.Fiber, goals.DailyFiberGoal, goals.DailyFiberLimit},
+		{"sodium", summary.Sodium, goals.DailySodiumGoal, goals.DailySodiumLimit},
+		{"sugar", summary.Sugar, goals.DailySugarGoal, goals.DailySugarLimit},
 	}
 
-	http.Error(w, "User not found", http.StatusNotFound)
+	result := make(map[string]models.NutrientProgress)
+	for _, n := range nutrients {
+		if n.target <= 0 && n.limit <= 0 {
+			continue
+		}
+
+		p := models.NutrientProgress{
+			Amount:    n.amount,
+			Target:    n.target,
+			Limit:     n.limit,
+			Deficit:   n.target > 0 && n.amount < n.target,
+			OverLimit: n.limit > 0 && n.amount > n.limit,
+		}
+		if n.target > 0 {
+			p.Percent = math.Round(n.amount/n.target*1000) / 10
+		} else {
+			p.Percent = math.Round(n.amount/n.limit*1000) / 10
+		}
+		result[n.name] = p
+	}
+	return result
 }
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// passwordCost is the bcrypt work factor for new hashes. Hashes stored with
+// a lower cost are upgraded the next time the user logs in.
+const passwordCost = 12
+
+// maxPasswordLength is the most bytes bcrypt can hash.
+const maxPasswordLength = 72
+
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// checkPassword verifies password against the stored value and reports
+// whether the stored value should be replaced with a fresh hash. Records
+// written before hashing was introduced hold the plaintext password; they
+// are still accepted so they can be upgraded on login.
+func checkPassword(stored, password string) (ok bool, needsRehash bool) {
+	if !isPasswordHash(stored) {
+		ok = subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return ok, ok
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) != nil {
+		return false, false
+	}
+
+	cost, err := bcrypt.Cost([]byte(stored))
+	return true, err != nil || cost < passwordCost
+}
+
+func isPasswordHash(stored string) bool {
+	return strings.HasPrefix(stored, "$2a$") ||
+		strings.HasPrefix(stored, "$2b$") ||
+		strings.HasPrefix(stored, "$2y$")
+}
@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"myjunkpal/models"
+	"myjunkpal/storage"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// Recipes are stored as foods with ingredients and a yield. Their
+// nutrition per serving is derived from the ingredients, so they can be
+// logged like any other food.
+type RecipeHandler struct {
+	foods storage.FoodRepo
+}
+
+func NewRecipeHandler(foods storage.FoodRepo) *RecipeHandler {
+	return &RecipeHandler{foods: foods}
+}
+
+// recipeError is a problem with a recipe sent by the client.
+type recipeError struct {
+	msg string
+}
+
+func (e *recipeError) Error() string {
+	return e.msg
+}
+
+func (h *RecipeHandler) GetRecipes(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
+	foods, err := h.foods.FoodsVisibleTo(currentUser.ID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var recipes []models.Food
+	for _, f := range foods {
+		if f.IsRecipe() {
+			recipes = append(recipes, f)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recipes)
+}
+
+func (h *RecipeHandler) CreateRecipe(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
+	var req models.CreateRecipeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recipe := models.Food{
+		ID:          uuid.New().String(),
+		UserID:      currentUser.ID,
+		Name:        req.Name,
+		ServingSize: req.ServingSize,
+		Category:    req.Category,
+		Tags:        req.Tags,
+		Ingredients: req.Ingredients,
+		Yield:       &req.Yield,
+		Version:     1,
+		CreatedAt:   time.Now(),
+	}
+
+	if !h.build(w, &recipe) {
+		return
+	}
+
+	if err := h.foods.CreateFood(recipe); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	setETag(w, recipe.Version)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(recipe)
+}
+
+func (h *RecipeHandler) UpdateRecipe(w http.ResponseWriter, r *http.Request) {
+	currentUser := UserFromContext(r.Context())
+
+	vars := mux.Vars(r)
+	id := vars["id"]
+
+	var req models.UpdateRecipeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	recipe, err := h.foods.GetFood(id)
+	if errors.Is(err, storage.ErrNotFound) || (err == nil && !recipe.IsRecipe()) {
+		http.Error(w, "Recipe not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Check if user owns this recipe
+	if recipe.UserID != currentUser.ID {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if ifMatchFails(r, recipe.Version) {
+		writePreconditionFailed(w)
+		return
+	}
+
+	// Update fields
+	recipe.Name = req.Name
+	recipe.Category = req.Category
+	recipe.Tags = req.Tags
+	recipe.Ingredients = req.Ingredients
+	recipe.Yield = &req.Yield
+	recipe.ServingSize = req.ServingSize
+
+	if !h.build(w, recipe) {
+		return
+	}
+
+	err = h.foods.UpdateFood(*recipe)
+	if errors.Is(err, storage.ErrVersionConflict) {
+		writePreconditionFailed(w)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	recipe.Version++
+
+	refreshRecipesUsing(h.foods, recipe.ID)
+
+	setETag(w, recipe.Version)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recipe)
+}
+
+// build checks a recipe sent by the client and runs buildRecipe, then
+// validates the result as a food, writing the error response if any of it
+// fails.
+func (h *RecipeHandler) build(w http.ResponseWriter, recipe *models.Food) bool {
+	err := checkIngredients(h.foods, recipe)
+	if err == nil {
+		err = buildRecipe(h.foods, recipe)
+	}
+
+	var invalid *recipeError
+	if errors.As(err, &invalid) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return false
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return false
+	}
+
+	// Warnings are left out: the nutrition comes from the ingredients
+	if errs, _ := validateFood(recipe); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return false
+	}
+	return true
+}
+
+// checkIngredients rejects deleted foods as ingredients of a recipe being
+// saved. A recipe already containing a food when it was deleted keeps it
+// until it's next saved, and is still recomputed when its other
+// ingredients change.
+func checkIngredients(foods storage.FoodRepo, recipe *models.Food) error {
+	for i, ing := range recipe.Ingredients {
+		food, err := foods.GetFood(ing.FoodID)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue // Reported by buildRecipe
+		}
+		if err != nil {
+			return err
+		}
+		if !food.ArchivedAt.IsZero() && (food.UserID == "" || food.UserID == recipe.UserID) {
+			return &recipeError{fmt.Sprintf("Ingredient %d: %s has been deleted", i+1, food.Name)}
+		}
+	}
+	return nil
+}
+
+// buildRecipe checks a recipe's ingredients and yield, then derives its
+// nutrition per serving from the current version of each ingredient.
+// A yield in servings makes one serving a fraction of the recipe; a yield
+// by weight makes it ServingSize grams (100 by default).
+func buildRecipe(foods storage.FoodRepo, recipe *models.Food) error {
+	if len(recipe.Ingredients) == 0 {
+		return &recipeError{"A recipe needs at least one ingredient"}
+	}
+
+	yield := recipe.Yield
+	if yield == nil || yield.Servings < 0 || yield.Weight < 0 || (yield.Servings > 0) == (yield.Weight > 0) {
+		return &recipeError{"Set exactly one of yield.servings or yield.weight"}
+	}
+
+	recipe.Tags = normalizeLabels(recipe.Tags)
+	if len(recipe.Tags) > maxTags {
+		return &recipeError{fmt.Sprintf("A recipe can have at most %d tags", maxTags)}
+	}
+
+	// A recipe contains every allergen of its ingredients and suits only
+	// the diets all of them suit
+	var total models.Food
+	var allergens, diets []string
+	recipe.Ingredients = append([]models.Ingredient(nil), recipe.Ingredients...)
+	for i := range recipe.Ingredients {
+		ing := &recipe.Ingredients[i]
+		if ing.Quantity <= 0 {
+			return &recipeError{fmt.Sprintf("Ingredient %d: quantity must be positive", i+1)}
+		}
+		if ing.FoodID == recipe.ID {
+			return &recipeError{fmt.Sprintf("Ingredient %d: a recipe can't contain itself", i+1)}
+		}
+
+		food, err := foods.GetFood(ing.FoodID)
+		if errors.Is(err, storage.ErrNotFound) || (err == nil && food.UserID != "" && food.UserID != recipe.UserID) {
+			return &recipeError{fmt.Sprintf("Ingredient %d: food %s not found", i+1, ing.FoodID)}
+		}
+		if err != nil {
+			return err
+		}
+
+		if food.IsRecipe() {
+			nested, err := recipeUses(foods, food, recipe.ID)
+			if err != nil {
+				return err
+			}
+			if nested {
+				return &recipeError{fmt.Sprintf("Ingredient %d: %s contains this recipe", i+1, food.Name)}
+			}
+		}
+
+		ing.FoodName = food.Name
+		allergens = append(allergens, food.Allergens...)
+		if i == 0 {
+			diets = slices.Clone(food.Diets)
+		} else {
+			diets = slices.DeleteFunc(diets, func(d string) bool { return !slices.Contains(food.Diets, d) })
+		}
+		total.Calories += food.Calories * ing.Quantity
+		total.Protein += food.Protein * ing.Quantity
+		total.Carbs += food.Carbs * ing.Quantity
+		total.Fats += food.Fats * ing.Quantity
+		total.Micronutrients = total.Micronutrients.Add(food.Micronutrients.Scale(ing.Quantity))
+	}
+
+	var servings float64
+	if yield.Servings > 0 {
+		recipe.ServingSize = 1
+		recipe.ServingUnit = "serving"
+		servings = yield.Servings
+	} else {
+		if recipe.ServingSize <= 0 {
+			recipe.ServingSize = 100
+		}
+		recipe.ServingUnit = "g"
+		servings = yield.Weight / recipe.ServingSize
+	}
+
+	recipe.Calories = total.Calories / servings
+	recipe.Protein = total.Protein / servings
+	recipe.Carbs = total.Carbs / servings
+	recipe.Fats = total.Fats / servings
+	recipe.Micronutrients = total.Micronutrients.Scale(1 / servings)
+	recipe.Allergens = normalizeLabels(allergens)
+	recipe.Diets = normalizeLabels(diets)
+	return nil
+}
+
+// recipeUses reports whether recipe contains the food with the given ID,
+// directly or through nested recipes.
+func recipeUses(foods storage.FoodRepo, recipe *models.Food, id string) (bool, error) {
+	for _, ing := range recipe.Ingredients {
+		if ing.FoodID == id {
+			return true, nil
+		}
+
+		food, err := foods.GetFood(ing.FoodID)
+		if errors.Is(err, storage.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		if food.IsRecipe() {
+			if found, err := recipeUses(foods, food, id); found || err != nil {
+				return found, err
+			}
+		}
+	}
+	return false, nil
+}
+
+// refreshRecipesUsing recomputes the recipes containing a food after the
+// food changed, then the recipes containing those. Each recipe gets a new
+// version, so entries already logged against it keep their nutrition.
+func refreshRecipesUsing(foods storage.FoodRepo, foodID string) {
+	recipes, err := foods.RecipesUsing(foodID)
+	if err != nil {
+		log.Printf("Warning: failed to find recipes using food %s: %v", foodID, err)
+		return
+	}
+
+	for _, recipe := range recipes {
+		if !recipe.ArchivedAt.IsZero() {
+			continue
+		}
+
+		if err := buildRecipe(foods, &recipe); err != nil {
+			log.Printf("Warning: failed to recompute recipe %s: %v", recipe.ID, err)
+			continue
+		}
+
+		// On a version conflict the recipe was just saved by someone else,
+		// who recomputed it from the same ingredients
+		if err := foods.UpdateFood(recipe); err != nil {
+			if !errors.Is(err, storage.ErrVersionConflict) {
+				log.Printf("Warning: failed to save recipe %s: %v", recipe.ID, err)
+			}
+			continue
+		}
+
+		refreshRecipesUsing(foods, recipe.ID)
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"myjunkpal/models"
+	"myjunkpal/search"
+)
+
+// A food is a search result when the query's words are this well covered
+// by its name, so every word has to be there, give or take a typo.
+const searchThreshold = 0.7
+
+// rankFoods matches foods against query, or keeps them all when query is
+// empty, and orders them best first. Only the foods ix offers as
+// candidates are scored. The user's own foods and the foods they log most
+// rank higher; ties keep catalog order.
+func rankFoods(ix *search.Index, foods []models.Food, query, userID string, logged map[string]int) []models.Food {
+	var matches []foodMatch
+	if tokens := search.Tokens(query); len(tokens) > 0 {
+		candidates := ix.Candidates(tokens)
+		for _, f := range foods {
+			if !candidates[f.ID] {
+				continue
+			}
+			name := search.Tokens(f.Name)
+			if search.Coverage(tokens, name) >= searchThreshold {
+				matches = append(matches, foodMatch{food: f, score: search.Score(tokens, name)})
+			}
+		}
+	} else {
+		for _, f := range foods {
+			// A query of only stopwords like "raw" still filters by name
+			if query == "" || strings.Contains(strings.ToLower(f.Name), strings.ToLower(query)) {
+				matches = append(matches, foodMatch{food: f})
+			}
+		}
+	}
+
+	for i := range matches {
+		m := &matches[i]
+		if m.food.UserID != "" && m.food.UserID == userID {
+			m.score += 0.1
+		}
+		if n := logged[m.food.ID]; n > 0 {
+			m.score += min(0.2, 0.05*math.Log2(1+float64(n)))
+		}
+	}
+
+	slices.SortStableFunc(matches, func(a, b foodMatch) int {
+		switch {
+		case a.score > b.score:
+			return -1
+		case a.score < b.score:
+			return 1
+		}
+		return 0
+	})
+
+	ranked := make([]models.Food, len(matches))
+	for i, m := range matches {
+		ranked[i] = m.food
+	}
+	return ranked
+}
+
+// foodSorts are the orders GetFoods can sort by besides relevance.
+var foodSorts = map[string]func(a, b *models.Food) int{
+	"name": func(a, b *models.Food) int {
+		return strings.Compare(strings.ToLower(a.Name), strings.ToLower(b.Name))
+	},
+	"calories": func(a, b *models.Food) int { return compareFloat(a.Calories, b.Calories) },
+	"protein":  func(a, b *models.Food) int { return compareFloat(a.Protein, b.Protein) },
+	"carbs":    func(a, b *models.Food) int { return compareFloat(a.Carbs, b.Carbs) },
+	"fats":     func(a, b *models.Food) int { return compareFloat(a.Fats, b.Fats) },
+	"created":  func(a, b *models.Food) int { return a.CreatedAt.Compare(b.CreatedAt) },
+}
+
+func compareFloat(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// sortFoods sorts foods by one of foodSorts, descending when the key
+// starts with "-". Relevance, the default, leaves them as they are.
+func sortFoods(foods []models.Food, key string) error {
+	desc := strings.HasPrefix(key, "-")
+	key = strings.TrimPrefix(key, "-")
+	if key == "" || key == "relevance" {
+		return nil
+	}
+
+	cmp, ok := foodSorts[key]
+	if !ok {
+		return fmt.Errorf("Unknown sort %q, use relevance, name, calories, protein, carbs, fats or created, with - for descending", key)
+	}
+	slices.SortStableFunc(foods, func(a, b models.Food) int {
+		if desc {
+			return cmp(&b, &a)
+		}
+		return cmp(&a, &b)
+	})
+	return nil
+}
+
+// pageParams reads the limit and offset query parameters. A limit of 0
+// means no limit.
+func pageParams(r *http.Request) (limit, offset int, err error) {
+	for name, dest := range map[string]*int{"limit": &limit, "offset": &offset} {
+		s := r.URL.Query().Get(name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			return 0, 0, fmt.Errorf("Invalid %s, use a whole number of 0 or more", name)
+		}
+		*dest = n
+	}
+	return limit, offset, nil
+}
+
+// paginate returns the page of items selected by limit and offset.
+func paginate[T any](items []T, limit, offset int) []T {
+	if offset >= len(items) {
+		return items[:0]
+	}
+	items = items[offset:]
+	if limit > 0 && limit < len(items) {
+		items = items[:limit]
+	}
+	return items
+}
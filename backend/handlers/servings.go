@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"myjunkpal/models"
+	"myjunkpal/units"
+)
+
+// converterFor returns a converter that knows food's density and portions.
+func converterFor(food *models.Food) units.Converter {
+	c := units.Converter{Density: food.Density}
+	for _, p := range food.Portions {
+		if u, ok := units.Lookup(p.Unit); ok {
+			c.Portions = append(c.Portions, units.Portion{Name: p.Name, Amount: p.Amount, Unit: u})
+		}
+	}
+	return c
+}
+
+// servingsFor converts an amount of food to a number of its servings. An
+// empty unit means quantity already is a number of servings; otherwise
+// unit is a unit of mass or volume or one of the food's portions.
+func servingsFor(food *models.Food, quantity float64, unit string) (float64, error) {
+	if unit == "" {
+		return quantity, nil
+	}
+
+	c := converterFor(food)
+	if _, ok := units.Lookup(unit); !ok && !c.HasPortion(unit) {
+		return 0, fmt.Errorf("Unknown unit %q for %s", unit, food.Name)
+	}
+	if food.ServingSize <= 0 {
+		return 0, fmt.Errorf("%s has no serving size to convert %s to", food.Name, unit)
+	}
+
+	amount, err := c.Convert(quantity, unit, food.ServingUnit)
+	if errors.Is(err, units.ErrIncompatible) {
+		return 0, fmt.Errorf("Can't convert %s to %s for %s without its density", unit, food.ServingUnit, food.Name)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("Can't convert %s to %s for %s", unit, food.ServingUnit, food.Name)
+	}
+	return amount / food.ServingSize, nil
+}
+
+// convertServings converts a number of servings of one food to servings
+// of another, through their serving sizes. It fails when the serving
+// units can't be converted, e.g. "1 medium" to grams without a portion.
+func convertServings(quantity float64, from, to *models.Food) (float64, bool) {
+	if from.ServingSize <= 0 || to.ServingSize <= 0 {
+		return 0, false
+	}
+	if strings.EqualFold(from.ServingUnit, to.ServingUnit) {
+		return quantity * from.ServingSize / to.ServingSize, true
+	}
+
+	servings, err := servingsFor(to, quantity*from.ServingSize, from.ServingUnit)
+	return servings, err == nil
+}
+
+// moveEntry points entry at food to instead of from and recalculates it,
+// keeping the amount eaten where the foods' units allow. An amount in a
+// unit to doesn't know is dropped in favour of the servings it came to.
+func moveEntry(entry *models.Entry, from, to *models.Food) {
+	if servings, err := servingsFor(to, entry.Amount, entry.Unit); entry.Unit != "" && err == nil {
+		entry.Quantity = servings
+	} else {
+		entry.Amount, entry.Unit = 0, ""
+		if servings, ok := convertServings(entry.Quantity, from, to); ok {
+			entry.Quantity = servings
+		}
+	}
+
+	entry.FoodID = to.ID
+	applyFood(entry, to)
+}
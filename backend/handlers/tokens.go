@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"myjunkpal/models"
+	"myjunkpal/storage"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AccessToken  = "access"
+	RefreshToken = "refresh"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+	ErrTokenRevoked = errors.New("token revoked")
+)
+
+// tokenHeader is the fixed JWT header for HMAC-SHA256 signed tokens.
+var tokenHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// TokenManager issues and validates JWT-style bearer tokens signed with a
+// server-side key. Revoked token IDs are persisted until the tokens would
+// have expired anyway.
+type TokenManager struct {
+	revoked    storage.TokenRepo
+	key        []byte
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+}
+
+func NewTokenManager(revoked storage.TokenRepo, key []byte, accessTTL, refreshTTL time.Duration) *TokenManager {
+	return &TokenManager{
+		revoked:    revoked,
+		key:        key,
+		accessTTL:  accessTTL,
+		refreshTTL: refreshTTL,
+	}
+}
+
+// Issue creates a new access/refresh token pair for the user.
+func (m *TokenManager) Issue(user models.User) (models.AuthResponse, error) {
+	now := time.Now()
+
+	access, err := m.sign(models.TokenClaims{
+		Subject:   user.ID,
+		Type:      AccessToken,
+		ID:        uuid.New().String(),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(m.accessTTL).Unix(),
+	})
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+
+	refresh, err := m.sign(models.TokenClaims{
+		Subject:   user.ID,
+		Type:      RefreshToken,
+		ID:        uuid.New().String(),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(m.refreshTTL).Unix(),
+	})
+	if err != nil {
+		return models.AuthResponse{}, err
+	}
+
+	return models.AuthResponse{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresAt:    time.Unix(now.Add(m.accessTTL).Unix(), 0),
+		User:         user,
+	}, nil
+}
+
+// Validate checks the token's signature, type, expiry and revocation status
+// and returns its claims.
+func (m *TokenManager) Validate(token, tokenType string) (*models.TokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != tokenHeader {
+		return nil, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(signature, m.signature(parts[0]+"."+parts[1])) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var claims models.TokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if claims.Type != tokenType || claims.Subject == "" || claims.ID == "" {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+
+	revoked, err := m.revoked.IsTokenRevoked(claims.ID)
+	if err != nil {
+		return nil, err
+	}
+	if revoked {
+		return nil, ErrTokenRevoked
+	}
+
+	return &claims, nil
+}
+
+// Revoke records the token ID so it is rejected until it expires. It
+// returns ErrTokenRevoked if it already was, so of several requests using
+// the same token only one succeeds.
+func (m *TokenManager) Revoke(claims *models.TokenClaims) error {
+	err := m.revoked.RevokeToken(models.RevokedToken{
+		ID:        claims.ID,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	})
+	if errors.Is(err, storage.ErrAlreadyRevoked) {
+		return ErrTokenRevoked
+	}
+	return err
+}
+
+func (m *TokenManager) sign(claims models.TokenClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	unsigned := tokenHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + base64.RawURLEncoding.EncodeToString(m.signature(unsigned)), nil
+}
+
+func (m *TokenManager) signature(unsigned string) []byte {
+	mac := hmac.New(sha256.New, m.key)
+	mac.Write([]byte(unsigned))
+	return mac.Sum(nil)
+}
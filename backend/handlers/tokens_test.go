@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"myjunkpal/models"
+	"myjunkpal/storage"
+)
+
+// memoryTokens is a TokenRepo keeping revoked token IDs in a map.
+type memoryTokens struct {
+	mu      sync.Mutex
+	revoked map[string]bool
+}
+
+func (m *memoryTokens) RevokeToken(token models.RevokedToken) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.revoked[token.ID] {
+		return storage.ErrAlreadyRevoked
+	}
+	m.revoked[token.ID] = true
+	return nil
+}
+
+func (m *memoryTokens) IsTokenRevoked(id string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.revoked[id], nil
+}
+
+func newTestTokens(accessTTL time.Duration) *TokenManager {
+	return NewTokenManager(&memoryTokens{revoked: make(map[string]bool)}, []byte("test key"), accessTTL, time.Hour)
+}
+
+func TestValidate(t *testing.T) {
+	user := models.User{ID: "user-1"}
+	tokens := newTestTokens(time.Minute)
+	pair, err := tokens.Issue(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expired, err := newTestTokens(-time.Minute).Issue(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := NewTokenManager(&memoryTokens{revoked: make(map[string]bool)}, []byte("other key"), time.Minute, time.Hour).Issue(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	parts := strings.Split(pair.AccessToken, ".")
+	// The refresh token's payload under the access token's signature
+	swapped := parts[0] + "." + strings.Split(pair.RefreshToken, ".")[1] + "." + parts[2]
+
+	tests := []struct {
+		name      string
+		token     string
+		tokenType string
+		want      error
+	}{
+		{"access", pair.AccessToken, AccessToken, nil},
+		{"refresh", pair.RefreshToken, RefreshToken, nil},
+		{"refresh as access", pair.RefreshToken, AccessToken, ErrInvalidToken},
+		{"access as refresh", pair.AccessToken, RefreshToken, ErrInvalidToken},
+		{"expired", expired.AccessToken, AccessToken, ErrTokenExpired},
+		{"signed with another key", otherKey.AccessToken, AccessToken, ErrInvalidToken},
+		{"payload swapped", swapped, RefreshToken, ErrInvalidToken},
+		{"signature dropped", parts[0] + "." + parts[1] + ".", AccessToken, ErrInvalidToken},
+		{"too few parts", parts[0] + "." + parts[1], AccessToken, ErrInvalidToken},
+		{"empty", "", AccessToken, ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := tokens.Validate(tt.token, tt.tokenType)
+			if !errors.Is(err, tt.want) {
+				t.Fatalf("Validate() error = %v, want %v", err, tt.want)
+			}
+			if err == nil && (claims.Subject != user.ID || claims.Type != tt.tokenType) {
+				t.Errorf("Validate() = %+v, want subject %s and type %s", claims, user.ID, tt.tokenType)
+			}
+		})
+	}
+}
+
+func TestRevoke(t *testing.T) {
+	tokens := newTestTokens(time.Minute)
+	pair, err := tokens.Issue(models.User{ID: "user-1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := tokens.Validate(pair.RefreshToken, RefreshToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tokens.Revoke(claims); err != nil {
+		t.Fatalf("first Revoke() error = %v", err)
+	}
+	if err := tokens.Revoke(claims); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("second Revoke() error = %v, want %v", err, ErrTokenRevoked)
+	}
+	if _, err := tokens.Validate(pair.RefreshToken, RefreshToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("Validate() after Revoke() error = %v, want %v", err, ErrTokenRevoked)
+	}
+
+	// Revoking one token of the pair leaves the other valid
+	if _, err := tokens.Validate(pair.AccessToken, AccessToken); err != nil {
+		t.Errorf("Validate() of the access token error = %v", err)
+	}
+}
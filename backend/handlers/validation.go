@@ -0,0 +1,198 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+
+	"myjunkpal/barcode"
+	"myjunkpal/models"
+	"myjunkpal/units"
+)
+
+// Declared calories more than this far from what the macros give, as a
+// fraction of the latter, earn a warning. Fiber, alcohol, polyols and
+// label rounding all move real foods a little off 4/4/9, hence the slack.
+const (
+	atwaterTolerance = 0.2
+	atwaterSlack     = 10.0 // kcal, so small servings aren't flagged over rounding
+)
+
+const maxNameLength = 200
+
+const (
+	maxTags      = 20
+	maxTagLength = 40
+)
+
+// A food suiting these diets can't contain these allergens.
+var dietExcludes = map[string][]string{
+	"vegan":      {"dairy", "egg", "fish", "shellfish", "molluscs"},
+	"vegetarian": {"fish", "shellfish", "molluscs"},
+}
+
+// validateFood checks a food about to be saved, normalizing its category
+// and labels.
+// Errors make the food unusable and are reported with 422; warnings point
+// at values that are probably mistyped but are saved anyway.
+func validateFood(food *models.Food) (errs, warnings []models.FieldError) {
+	add := func(list *[]models.FieldError, field, format string, args ...any) {
+		*list = append(*list, models.FieldError{Field: field, Message: fmt.Sprintf(format, args...)})
+	}
+
+	switch name := strings.TrimSpace(food.Name); {
+	case name == "":
+		add(&errs, "name", "Name is required")
+	case len(name) > maxNameLength:
+		add(&errs, "name", "Name can't be longer than %d characters", maxNameLength)
+	}
+
+	category, err := checkCategory(food.Category)
+	if err != nil {
+		add(&errs, "category", "%v", err)
+	}
+	food.Category = category
+
+	if food.ServingSize <= 0 {
+		add(&errs, "serving_size", "Serving size must be positive")
+	}
+	if strings.TrimSpace(food.ServingUnit) == "" {
+		add(&errs, "serving_unit", "Serving unit is required")
+	}
+
+	for _, n := range []struct {
+		field string
+		value float64
+	}{
+		{"calories", food.Calories},
+		{"protein", food.Protein},
+		{"carbs", food.Carbs},
+		{"fats", food.Fats},
+	} {
+		if n.value < 0 {
+			add(&errs, n.field, "%s can't be negative", fieldLabel(n.field))
+		}
+	}
+
+	for _, n := range food.Micronutrients.Values() {
+		if n.Value < 0 {
+			add(&errs, n.Name, "%s can't be negative", fieldLabel(n.Name))
+		}
+	}
+	if food.Sugar > food.Carbs {
+		add(&errs, "sugar", "Sugar (%g g) can't be more than carbs (%g g)", food.Sugar, food.Carbs)
+	}
+	if food.SaturatedFat > food.Fats {
+		add(&errs, "saturated_fat", "Saturated fat (%g g) can't be more than fats (%g g)", food.SaturatedFat, food.Fats)
+	}
+
+	// A serving weighed in grams can't hold more grams of macros
+	if u, ok := units.Lookup(food.ServingUnit); ok && u.Dimension == units.Mass && food.ServingSize > 0 {
+		grams := food.ServingSize * u.Factor
+		if macros := food.Protein + food.Carbs + food.Fats; macros > grams*1.01 {
+			add(&errs, "serving_size", "Protein, carbs and fats add up to %g g, more than the %g g serving", macros, math.Round(grams*10)/10)
+		}
+	}
+
+	if food.Density < 0 {
+		add(&errs, "density", "Density can't be negative")
+	}
+	for i, p := range food.Portions {
+		field := fmt.Sprintf("portions[%d]", i)
+		if p.Name == "" {
+			add(&errs, field+".name", "Portion name is required")
+		}
+		if p.Amount <= 0 {
+			add(&errs, field+".amount", "Portion amount must be positive")
+		}
+		if _, ok := units.Lookup(p.Unit); !ok {
+			add(&errs, field+".unit", "Unknown unit %q, use a unit of mass or volume", p.Unit)
+		}
+	}
+
+	if food.Barcode != "" {
+		if _, err := barcode.Normalize(food.Barcode); err != nil {
+			add(&errs, "barcode", "Invalid barcode: %v", err)
+		}
+	}
+
+	food.Tags = normalizeLabels(food.Tags)
+	if len(food.Tags) > maxTags {
+		add(&errs, "tags", "A food can have at most %d tags", maxTags)
+	}
+	for _, tag := range food.Tags {
+		if len(tag) > maxTagLength {
+			add(&errs, "tags", "Tags can't be longer than %d characters", maxTagLength)
+			break
+		}
+	}
+
+	food.Allergens = normalizeLabels(food.Allergens)
+	if err := checkLabels("allergen", food.Allergens, models.Allergens); err != nil {
+		add(&errs, "allergens", "%v", err)
+	}
+	food.Diets = normalizeLabels(food.Diets)
+	if err := checkLabels("diet", food.Diets, models.Diets); err != nil {
+		add(&errs, "diets", "%v", err)
+	}
+	for _, d := range food.Diets {
+		for _, a := range dietExcludes[d] {
+			if slices.Contains(food.Allergens, a) {
+				add(&errs, "diets", "A %s food can't contain %s", d, a)
+			}
+		}
+	}
+
+	if len(errs) == 0 {
+		computed := 4*food.Protein + 4*food.Carbs + 9*food.Fats
+		if diff := math.Abs(food.Calories - computed); diff > max(atwaterTolerance*computed, atwaterSlack) {
+			add(&warnings, "calories", "%g kcal doesn't match the %.0f kcal that protein, carbs and fats give at 4/4/9 kcal per gram",
+				food.Calories, computed)
+		}
+	}
+
+	return errs, warnings
+}
+
+// normalizeLabels lowercases and trims tags, allergens or diets, dropping
+// blanks and repeats, and sorts them.
+func normalizeLabels(labels []string) []string {
+	var out []string
+	for _, l := range labels {
+		l = strings.ToLower(strings.TrimSpace(l))
+		if l != "" && !slices.Contains(out, l) {
+			out = append(out, l)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// checkLabels reports the first of labels that isn't one of known.
+func checkLabels(kind string, labels, known []string) error {
+	for _, l := range labels {
+		if !slices.Contains(known, l) {
+			return fmt.Errorf("Unknown %s %q, use one of %s", kind, l, strings.Join(known, ", "))
+		}
+	}
+	return nil
+}
+
+// fieldLabel turns a JSON field name like "vitamin_c" into "Vitamin c".
+func fieldLabel(field string) string {
+	label := strings.ReplaceAll(field, "_", " ")
+	return strings.ToUpper(label[:1]) + label[1:]
+}
+
+// writeValidationErrors writes the 422 response for invalid fields.
+func writeValidationErrors(w http.ResponseWriter, errs []models.FieldError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	json.NewEncoder(w).Encode(models.ValidationErrorResponse{
+		Error:  "Some fields are invalid",
+		Errors: errs,
+	})
+}
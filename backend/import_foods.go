@@ -0,0 +1,164 @@
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+
+	"myjunkpal/importer"
+	"myjunkpal/models"
+	"myjunkpal/storage"
+)
+
+// runImportFoods loads an Open Food Facts or USDA FoodData Central dump as
+// system foods:
+//
+//	myjunkpal import-foods --from en.openfoodfacts.org.products.csv.gz --to sqlite://./data/myjunkpal.db
+//	myjunkpal import-foods --from ./FoodData_Central_csv --to ./data
+func runImportFoods(args []string) {
+	fs := flag.NewFlagSet("import-foods", flag.ExitOnError)
+	from := fs.String("from", "", "dump to read: an Open Food Facts .csv or .jsonl file, optionally gzipped, or an unpacked USDA CSV directory")
+	format := fs.String("format", "", "off-csv, off-jsonl or usda; guessed from --from when empty")
+	to := fs.String("to", "./data", "destination store: sqlite://<path> or a JSON data directory")
+	batchSize := fs.Int("batch", 5000, "foods written per transaction")
+	dryRun := fs.Bool("dry-run", false, "read and count the dump without opening the store")
+	fs.Parse(args)
+
+	if *from == "" {
+		log.Fatal("Missing --from")
+	}
+	if *format == "" {
+		*format = guessFormat(*from)
+	}
+
+	// A dry run leaves the store alone, not even migrating a database, so
+	// it only catches duplicates within the dump
+	dedupe := importer.NewDeduper()
+	var loader storage.FoodLoader
+	if !*dryRun {
+		var closeStore func()
+		loader, closeStore = openFoodLoader(*to)
+		defer closeStore()
+
+		if err := loader.SystemFoods(func(f *models.Food) { dedupe.Seen(f) }); err != nil {
+			log.Fatal("Failed to read existing foods:", err)
+		}
+	}
+
+	var stats importer.Stats
+	var batch []models.Food
+	flush := func() error {
+		if len(batch) == 0 || *dryRun {
+			batch = batch[:0]
+			return nil
+		}
+		if err := loader.Add(batch); err != nil {
+			return err
+		}
+		batch = batch[:0]
+		log.Printf("Read %d products, imported %d", stats.Read, stats.Imported)
+		return nil
+	}
+	add := func(f models.Food) error {
+		if dedupe.Seen(&f) {
+			stats.Duplicates++
+			return nil
+		}
+		stats.Imported++
+		batch = append(batch, f)
+		if len(batch) >= *batchSize {
+			return flush()
+		}
+		return nil
+	}
+
+	var err error
+	switch *format {
+	case "usda":
+		err = importer.ReadUSDA(*from, &stats, add)
+	case "off-csv", "off-jsonl":
+		var r io.ReadCloser
+		if r, err = openDump(*from); err != nil {
+			log.Fatal("Failed to open dump:", err)
+		}
+		defer r.Close()
+		if *format == "off-csv" {
+			err = importer.ReadOFFCSV(r, &stats, add)
+		} else {
+			err = importer.ReadOFFJSONL(r, &stats, add)
+		}
+	default:
+		log.Fatalf("Unknown format %q, use off-csv, off-jsonl or usda", *format)
+	}
+	if err == nil {
+		err = flush()
+	}
+	if err == nil && loader != nil {
+		err = loader.Close()
+	}
+	if err != nil {
+		log.Fatalf("Import stopped after %d foods: %v", stats.Imported, err)
+	}
+
+	verb := "imported"
+	if *dryRun {
+		verb = "would import"
+	}
+	fmt.Printf("Read %d products: %s %d, skipped %d duplicates and %d without a name, energy or sane values\n",
+		stats.Read, verb, stats.Imported, stats.Duplicates, stats.Invalid)
+}
+
+// openFoodLoader opens the store named by a --to flag, sqlite://<path> or a
+// JSON data directory, returning a function that closes it.
+func openFoodLoader(to string) (storage.FoodLoader, func()) {
+	if path, ok := strings.CutPrefix(to, "sqlite://"); ok {
+		db, err := storage.OpenSQLite(path)
+		if err != nil {
+			log.Fatal("Failed to open sqlite database:", err)
+		}
+		return storage.NewSQLiteFoodLoader(db), func() { db.Close() }
+	}
+
+	store := storage.NewJSONStore(to)
+	if err := store.EnsureDataDir(); err != nil {
+		log.Fatal("Failed to create data directory:", err)
+	}
+	return storage.NewJSONFoodLoader(store), func() {}
+}
+
+// guessFormat picks the dump format from its path: a directory is a USDA
+// download, files go by extension.
+func guessFormat(path string) string {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return "usda"
+	}
+	if strings.Contains(strings.TrimSuffix(path, ".gz"), ".jsonl") {
+		return "off-jsonl"
+	}
+	return "off-csv"
+}
+
+// openDump opens a file, decompressing it if it's gzipped.
+func openDump(path string) (io.ReadCloser, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(path, ".gz") {
+		return file, nil
+	}
+
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{gz, file}, nil
+}
@@ -0,0 +1,148 @@
+// Package importer reads food databases downloaded from Open Food Facts
+// and USDA FoodData Central and turns their products into system foods.
+// Dumps are read a row at a time, so they can be far larger than memory.
+package importer
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"myjunkpal/barcode"
+	"myjunkpal/categories"
+	"myjunkpal/models"
+)
+
+// Stats counts what happened to the products in a dump.
+type Stats struct {
+	Read       int // Products read
+	Invalid    int // Without a name or energy, or with impossible values
+	Duplicates int // Already stored, or earlier in the dump
+	Imported   int
+}
+
+// nutrient maps a models.Food field to its name in each source. Foods
+// hold nutrients per 100 g, in unit.
+type nutrient struct {
+	off   string // Open Food Facts key, before "_100g"
+	usda  string // USDA nutrient number
+	unit  string // g, mg, µg or kcal
+	field func(f *models.Food) *float64
+}
+
+var nutrients = [...]nutrient{
+	{"energy-kcal", "208", "kcal", func(f *models.Food) *float64 { return &f.Calories }},
+	{"proteins", "203", "g", func(f *models.Food) *float64 { return &f.Protein }},
+	{"carbohydrates", "205", "g", func(f *models.Food) *float64 { return &f.Carbs }},
+	{"fat", "204", "g", func(f *models.Food) *float64 { return &f.Fats }},
+	{"fiber", "291", "g", func(f *models.Food) *float64 { return &f.Fiber }},
+	{"sugars", "269", "g", func(f *models.Food) *float64 { return &f.Sugar }},
+	{"saturated-fat", "606", "g", func(f *models.Food) *float64 { return &f.SaturatedFat }},
+	{"sodium", "307", "mg", func(f *models.Food) *float64 { return &f.Sodium }},
+	{"potassium", "306", "mg", func(f *models.Food) *float64 { return &f.Potassium }},
+	{"cholesterol", "601", "mg", func(f *models.Food) *float64 { return &f.Cholesterol }},
+	{"vitamin-a", "320", "µg", func(f *models.Food) *float64 { return &f.VitaminA }},
+	{"vitamin-c", "401", "mg", func(f *models.Food) *float64 { return &f.VitaminC }},
+	{"vitamin-d", "328", "µg", func(f *models.Food) *float64 { return &f.VitaminD }},
+	{"vitamin-b12", "418", "µg", func(f *models.Food) *float64 { return &f.VitaminB12 }},
+	{"calcium", "301", "mg", func(f *models.Food) *float64 { return &f.Calcium }},
+	{"iron", "303", "mg", func(f *models.Food) *float64 { return &f.Iron }},
+	{"magnesium", "304", "mg", func(f *models.Food) *float64 { return &f.Magnesium }},
+	{"zinc", "309", "mg", func(f *models.Food) *float64 { return &f.Zinc }},
+}
+
+const kJPerKcal = 4.184
+
+// newFood returns a system food with nutrition per 100 g, to be filled in.
+// The brand is added to the name unless the name already has it. The
+// source's category is matched to the category tree, refined by the name,
+// so "Poultry Products" called "Chicken, breast, raw" is chicken; foods
+// whose category matches nothing are left without one.
+func newFood(id, name, brand, category string, now time.Time) models.Food {
+	var slug string
+	if n, ok := categories.Classify(category, name); ok {
+		slug = n.Slug
+	}
+
+	name = strings.TrimSpace(name)
+	brand = strings.TrimSpace(brand)
+	if brand != "" && name != "" && !strings.Contains(strings.ToLower(name), strings.ToLower(brand)) {
+		name += " (" + brand + ")"
+	}
+
+	return models.Food{
+		ID:          id,
+		Name:        name,
+		ServingSize: 100,
+		ServingUnit: "g",
+		Category:    slug,
+		Version:     1,
+		CreatedAt:   now,
+	}
+}
+
+// valid reports whether an imported food is usable: it has a name and
+// energy, and no more than 100 g of anything in 100 g.
+func valid(f *models.Food, hasEnergy bool) bool {
+	if f.Name == "" || !hasEnergy || f.Calories < 0 || f.Calories > 950 {
+		return false
+	}
+	for _, v := range []float64{f.Protein, f.Carbs, f.Fats, f.Fiber, f.Sugar, f.SaturatedFat} {
+		if v < 0 || v > 100 {
+			return false
+		}
+	}
+	return f.Protein+f.Carbs+f.Fats <= 105
+}
+
+// normalizeBarcode returns the product's barcode as stored on foods, or ""
+// for codes that aren't EAN-13 or UPC-A. GTIN-14 codes padded with a
+// leading 0 are accepted too.
+func normalizeBarcode(code string) string {
+	code = strings.TrimSpace(code)
+	if len(code) == 14 && code[0] == '0' {
+		code = code[1:]
+	}
+	code, err := barcode.Normalize(code)
+	if err != nil {
+		return ""
+	}
+	return code
+}
+
+// Deduper recognises foods that are already stored or were already seen
+// in a dump: the same ID, the same barcode, or, for foods without one,
+// the same name ignoring case and punctuation.
+type Deduper struct {
+	seen map[string]struct{}
+}
+
+func NewDeduper() *Deduper {
+	return &Deduper{seen: make(map[string]struct{})}
+}
+
+// Seen records the food and reports whether a matching one was recorded
+// before.
+func (d *Deduper) Seen(f *models.Food) bool {
+	keys := []string{"id:" + f.ID}
+	if f.Barcode != "" {
+		keys = append(keys, "barcode:"+f.Barcode)
+	} else {
+		keys = append(keys, "name:"+nameKey(f.Name))
+	}
+
+	dup := false
+	for _, k := range keys {
+		if _, ok := d.seen[k]; ok {
+			dup = true
+		}
+		d.seen[k] = struct{}{}
+	}
+	return dup
+}
+
+func nameKey(name string) string {
+	return strings.Join(strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
@@ -0,0 +1,278 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"myjunkpal/models"
+)
+
+// Open Food Facts gives every nutrient except energy in grams per 100 g.
+var offScale = map[string]float64{"g": 1, "mg": 1e3, "µg": 1e6, "kcal": 1}
+
+// Open Food Facts allergen and label tags for models.Allergens and
+// models.Diets.
+var (
+	offAllergens = map[string]string{
+		"en:gluten": "gluten", "en:crustaceans": "shellfish", "en:eggs": "egg", "en:fish": "fish",
+		"en:peanuts": "peanuts", "en:soybeans": "soy", "en:milk": "dairy", "en:nuts": "nuts",
+		"en:celery": "celery", "en:mustard": "mustard", "en:sesame-seeds": "sesame",
+		"en:sulphur-dioxide-and-sulphites": "sulphites", "en:lupin": "lupin", "en:molluscs": "molluscs",
+	}
+	offDiets = map[string]string{
+		"en:vegan": "vegan", "en:vegetarian": "vegetarian", "en:halal": "halal", "en:kosher": "kosher",
+	}
+)
+
+// offProduct holds the fields used from one Open Food Facts product.
+type offProduct struct {
+	code, name, brands, category string
+	servingQuantity              float64
+	servingSize                  string   // As printed, e.g. "1 cup (240 ml)"
+	allergens, labels            []string // Tags like "en:milk" and "en:vegan"
+	nutriment                    func(key string) (float64, bool)
+}
+
+func (p *offProduct) food(now time.Time) (models.Food, bool) {
+	f := newFood("off-"+p.code, p.name, firstItem(p.brands), lastItem(p.category), now)
+	f.Barcode = normalizeBarcode(p.code)
+	f.Allergens = mapTags(p.allergens, offAllergens)
+	f.Diets = mapTags(p.labels, offDiets)
+
+	hasEnergy := false
+	for _, n := range nutrients {
+		if v, ok := p.nutriment(n.off + "_100g"); ok {
+			*n.field(&f) = v * offScale[n.unit]
+			hasEnergy = hasEnergy || n.unit == "kcal"
+		}
+	}
+	if !hasEnergy {
+		if kj, ok := p.nutriment("energy_100g"); ok {
+			f.Calories = math.Round(kj / kJPerKcal)
+			hasEnergy = true
+		}
+	}
+
+	if p.servingQuantity > 0 {
+		unit := "g"
+		if strings.Contains(strings.ToLower(p.servingSize), "ml") {
+			unit = "ml"
+		}
+		f.Portions = []models.Portion{{Name: "serving", Amount: p.servingQuantity, Unit: unit}}
+	}
+
+	return f, p.code != "" && valid(&f, hasEnergy)
+}
+
+// mapTags returns the sorted names of the tags found in names.
+func mapTags(tags []string, names map[string]string) []string {
+	var out []string
+	for _, t := range tags {
+		if name, ok := names[strings.ToLower(strings.TrimSpace(t))]; ok && !slices.Contains(out, name) {
+			out = append(out, name)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
+
+// firstItem returns the first of a comma separated list.
+func firstItem(list string) string {
+	item, _, _ := strings.Cut(list, ",")
+	return strings.TrimSpace(item)
+}
+
+// lastItem returns the last of a comma separated list, which for Open Food
+// Facts categories is the most specific.
+func lastItem(list string) string {
+	return strings.TrimSpace(list[strings.LastIndex(list, ",")+1:])
+}
+
+// ReadOFFCSV reads the Open Food Facts CSV export, which is tab separated,
+// calling fn with each valid product.
+func ReadOFFCSV(r io.Reader, stats *Stats, fn func(models.Food) error) error {
+	br := bufio.NewReaderSize(r, 1<<20)
+	header, err := br.ReadString('\n')
+	if err != nil && header == "" {
+		return fmt.Errorf("reading header: %w", err)
+	}
+	header = strings.TrimRight(header, "\r\n")
+
+	// The official export is tab separated without quoting; fall back to
+	// real CSV for files saved by other tools
+	var next func() ([]string, error)
+	sep := "\t"
+	if !strings.Contains(header, sep) {
+		sep = ","
+		cr := csv.NewReader(io.MultiReader(strings.NewReader(header+"\n"), br))
+		cr.FieldsPerRecord = -1
+		cr.LazyQuotes = true
+		cr.ReuseRecord = true
+		if _, err := cr.Read(); err != nil {
+			return err
+		}
+		next = cr.Read
+	} else {
+		next = func() ([]string, error) {
+			line, err := br.ReadString('\n')
+			if line == "" {
+				return nil, err
+			}
+			return strings.Split(strings.TrimRight(line, "\r\n"), sep), nil
+		}
+	}
+
+	columns := make(map[string]int)
+	for i, name := range strings.Split(header, sep) {
+		columns[strings.Trim(name, `"`)] = i
+	}
+	if _, ok := columns["code"]; !ok {
+		return errors.New("not an Open Food Facts export: no code column")
+	}
+
+	var row []string
+	get := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	now := time.Now()
+	for {
+		row, err = next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		stats.Read++
+
+		category := get("main_category_en")
+		if category == "" {
+			category = get("categories_en")
+		}
+		serving, _ := strconv.ParseFloat(get("serving_quantity"), 64)
+
+		p := offProduct{
+			code:            get("code"),
+			name:            get("product_name"),
+			brands:          get("brands"),
+			category:        category,
+			servingQuantity: serving,
+			servingSize:     get("serving_size"),
+			allergens:       strings.Split(get("allergens"), ","),
+			labels:          strings.Split(get("labels_tags"), ","),
+			nutriment: func(key string) (float64, bool) {
+				v, err := strconv.ParseFloat(get(key), 64)
+				return v, err == nil
+			},
+		}
+		f, ok := p.food(now)
+		if !ok {
+			stats.Invalid++
+			continue
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+}
+
+// flexFloat decodes a JSON number that may also be written as a string,
+// remembering whether it was present.
+type flexFloat struct {
+	v  float64
+	ok bool
+}
+
+func (f *flexFloat) UnmarshalJSON(data []byte) error {
+	data = bytes.Trim(data, `"`)
+	v, err := strconv.ParseFloat(string(data), 64)
+	*f = flexFloat{v, err == nil}
+	return nil
+}
+
+// flexString decodes a JSON string that may also be written as a number.
+type flexString string
+
+func (s *flexString) UnmarshalJSON(data []byte) error {
+	var str string
+	if err := json.Unmarshal(data, &str); err != nil {
+		str = string(data)
+	}
+	*s = flexString(str)
+	return nil
+}
+
+// ReadOFFJSONL reads the Open Food Facts JSONL export, one product per
+// line, calling fn with each valid product.
+func ReadOFFJSONL(r io.Reader, stats *Stats, fn func(models.Food) error) error {
+	br := bufio.NewReaderSize(r, 1<<20)
+	now := time.Now()
+
+	for lineNo := 1; ; lineNo++ {
+		line, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(line)) > 0 {
+			stats.Read++
+
+			var raw struct {
+				Code            flexString           `json:"code"`
+				ProductName     string               `json:"product_name"`
+				ProductNameEn   string               `json:"product_name_en"`
+				Brands          string               `json:"brands"`
+				Categories      string               `json:"categories"`
+				ServingQuantity flexFloat            `json:"serving_quantity"`
+				ServingSize     string               `json:"serving_size"`
+				AllergensTags   []string             `json:"allergens_tags"`
+				LabelsTags      []string             `json:"labels_tags"`
+				Nutriments      map[string]flexFloat `json:"nutriments"`
+			}
+			if jsonErr := json.Unmarshal(line, &raw); jsonErr != nil {
+				return fmt.Errorf("line %d: %w", lineNo, jsonErr)
+			}
+
+			name := raw.ProductName
+			if name == "" {
+				name = raw.ProductNameEn
+			}
+			p := offProduct{
+				code:            strings.TrimSpace(string(raw.Code)),
+				name:            name,
+				brands:          raw.Brands,
+				category:        raw.Categories,
+				servingQuantity: raw.ServingQuantity.v,
+				servingSize:     raw.ServingSize,
+				allergens:       raw.AllergensTags,
+				labels:          raw.LabelsTags,
+				nutriment: func(key string) (float64, bool) {
+					n := raw.Nutriments[key]
+					return n.v, n.ok
+				},
+			}
+			if f, ok := p.food(now); !ok {
+				stats.Invalid++
+			} else if err := fn(f); err != nil {
+				return err
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package importer
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"myjunkpal/models"
+)
+
+// USDA data types worth importing; the rest are lab samples of these.
+var usdaDataTypes = map[string]bool{
+	"foundation_food":   true,
+	"sr_legacy_food":    true,
+	"survey_fndds_food": true,
+	"branded_food":      true,
+}
+
+// USDA nutrient numbers for energy computed with Atwater factors, used
+// when a food has no plain energy value. Specific factors are preferred.
+var usdaEnergyFallbacks = [...]string{"958", "957"}
+
+// USDA units as spelt in nutrient.csv.
+var usdaUnits = map[string]string{"g": "G", "mg": "MG", "µg": "UG", "kcal": "KCAL"}
+
+// usdaFood is what's gathered about a food from the files listing it.
+type usdaFood struct {
+	name, brand, category, barcode string
+	values                         [len(nutrientSlots)]float64
+	has                            [len(nutrientSlots)]bool
+	portions                       []models.Portion
+}
+
+// nutrientSlots are the positions of usdaFood.values: the nutrients
+// followed by the energy fallbacks.
+var nutrientSlots = func() (slots [len(nutrients) + len(usdaEnergyFallbacks)]string) {
+	for i, n := range nutrients {
+		slots[i] = n.usda
+	}
+	copy(slots[len(nutrients):], usdaEnergyFallbacks[:])
+	return slots
+}()
+
+// ReadUSDA reads a FoodData Central CSV download unpacked in dir, calling
+// fn with each valid food in fdc_id order. food.csv, nutrient.csv and
+// food_nutrient.csv are required; food_category.csv, branded_food.csv,
+// food_portion.csv and measure_unit.csv are used when present.
+//
+// The files listing foods are read side by side, as FoodData Central
+// sorts them by fdc_id, so each food is passed to fn once every file has
+// moved past it and only one food is held in memory at a time.
+func ReadUSDA(dir string, stats *Stats, fn func(models.Food) error) error {
+	// Which slot each nutrient ID fills, checking units match ours
+	slotOf := make(map[string]int)
+	err := readCSV(dir, "nutrient.csv", true, func(get func(string) string) error {
+		i := slices.Index(nutrientSlots[:], get("nutrient_nbr"))
+		if i < 0 {
+			return nil
+		}
+		want := "KCAL"
+		if i < len(nutrients) {
+			want = usdaUnits[nutrients[i].unit]
+		}
+		if strings.EqualFold(get("unit_name"), want) {
+			slotOf[get("id")] = i
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	categories := make(map[string]string)
+	err = readCSV(dir, "food_category.csv", false, func(get func(string) string) error {
+		categories[get("id")] = get("description")
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	measures := make(map[string]string)
+	err = readCSV(dir, "measure_unit.csv", false, func(get func(string) string) error {
+		measures[get("id")] = get("name")
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	foods, err := openFoodRows(dir, "food.csv", true)
+	if err != nil {
+		return err
+	}
+	defer foods.Close()
+	branded, err := openFoodRows(dir, "branded_food.csv", false)
+	if err != nil {
+		return err
+	}
+	defer branded.Close()
+	portions, err := openFoodRows(dir, "food_portion.csv", false)
+	if err != nil {
+		return err
+	}
+	defer portions.Close()
+	amounts, err := openFoodRows(dir, "food_nutrient.csv", true)
+	if err != nil {
+		return err
+	}
+	defer amounts.Close()
+
+	now := time.Now()
+	for !foods.done {
+		id := foods.id
+		imported := usdaDataTypes[foods.get("data_type")]
+		u := &usdaFood{name: foods.get("description"), category: categories[foods.get("food_category_id")]}
+		if err := foods.next(); err != nil {
+			return err
+		}
+
+		if err := branded.through(id, u.addBranding); err != nil {
+			return err
+		}
+		if err := portions.through(id, func(get func(string) string) { u.addPortion(get, measures) }); err != nil {
+			return err
+		}
+		if err := amounts.through(id, func(get func(string) string) { u.addNutrient(get, slotOf) }); err != nil {
+			return err
+		}
+
+		if !imported {
+			continue
+		}
+		stats.Read++
+		f, ok := u.food(id, now)
+		if !ok {
+			stats.Invalid++
+			continue
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (u *usdaFood) addBranding(get func(string) string) {
+	u.brand = get("brand_name")
+	if u.brand == "" {
+		u.brand = get("brand_owner")
+	}
+	u.barcode = normalizeBarcode(get("gtin_upc"))
+	if c := get("branded_food_category"); c != "" {
+		u.category = c
+	}
+
+	size, _ := strconv.ParseFloat(get("serving_size"), 64)
+	unit := strings.ToLower(get("serving_size_unit"))
+	if size > 0 && (unit == "g" || unit == "ml") {
+		u.portions = append(u.portions, models.Portion{Name: "serving", Amount: size, Unit: unit})
+	}
+}
+
+func (u *usdaFood) addPortion(get func(string) string, measures map[string]string) {
+	amount, _ := strconv.ParseFloat(get("amount"), 64)
+	grams, _ := strconv.ParseFloat(get("gram_weight"), 64)
+	if grams <= 0 {
+		return
+	}
+	if amount <= 0 {
+		amount = 1
+	}
+
+	// "1 cup, chopped" is a cup; "1 large" has its size as modifier
+	name := measures[get("measure_unit_id")]
+	if name == "" || name == "undetermined" {
+		name = get("modifier")
+		if name == "" {
+			name = get("portion_description")
+		}
+	}
+	name = strings.TrimSpace(strings.ToLower(name))
+	if name == "" || slices.ContainsFunc(u.portions, func(p models.Portion) bool { return p.Name == name }) {
+		return
+	}
+	u.portions = append(u.portions, models.Portion{Name: name, Amount: grams / amount, Unit: "g"})
+}
+
+func (u *usdaFood) addNutrient(get func(string) string, slotOf map[string]int) {
+	slot, ok := slotOf[get("nutrient_id")]
+	if !ok {
+		return
+	}
+	if v, err := strconv.ParseFloat(get("amount"), 64); err == nil {
+		u.values[slot] = v
+		u.has[slot] = true
+	}
+}
+
+// food returns the food with the given fdc_id, and whether it's valid.
+func (u *usdaFood) food(id int, now time.Time) (models.Food, bool) {
+	f := newFood(fmt.Sprintf("usda-%d", id), u.name, u.brand, u.category, now)
+	f.Barcode = u.barcode
+	f.Portions = u.portions
+	for i, n := range nutrients {
+		*n.field(&f) = u.values[i]
+	}
+
+	hasEnergy := u.has[0]
+	for i := len(nutrients); !hasEnergy && i < len(nutrientSlots); i++ {
+		if u.has[i] {
+			f.Calories = u.values[i]
+			hasEnergy = true
+		}
+	}
+	return f, valid(&f, hasEnergy)
+}
+
+// foodRows reads a CSV file listing foods by fdc_id a row at a time,
+// checking the IDs never go down. Rows without a numeric fdc_id are
+// skipped.
+type foodRows struct {
+	*csvFile
+	id   int  // fdc_id of the current row
+	done bool // Past the last row
+}
+
+// openFoodRows opens a CSV file in dir and reads its first row. A missing
+// optional file reads as empty.
+func openFoodRows(dir, name string, required bool) (*foodRows, error) {
+	file, err := openCSV(dir, name, required)
+	if err != nil {
+		return nil, err
+	}
+	rows := &foodRows{csvFile: file, id: -1, done: file == nil}
+	if rows.done {
+		return rows, nil
+	}
+	if err := rows.next(); err != nil {
+		rows.Close()
+		return nil, err
+	}
+	return rows, nil
+}
+
+// through calls fn with each row for the food id, skipping rows for
+// foods before it.
+func (r *foodRows) through(id int, fn func(get func(column string) string)) error {
+	for !r.done && r.id <= id {
+		if r.id == id {
+			fn(r.get)
+		}
+		if err := r.next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *foodRows) next() error {
+	for {
+		if err := r.read(); errors.Is(err, io.EOF) {
+			r.done = true
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		id, err := strconv.Atoi(r.get("fdc_id"))
+		if err != nil {
+			continue
+		}
+		if id < r.id {
+			return fmt.Errorf("%s: fdc_id %d comes after %d; the file must be sorted by fdc_id", r.name, id, r.id)
+		}
+		r.id = id
+		return nil
+	}
+}
+
+func (r *foodRows) Close() {
+	if r.csvFile != nil {
+		r.csvFile.Close()
+	}
+}
+
+// readCSV calls fn for each row of a CSV file in dir, with a getter for
+// its columns by header name. A missing optional file is skipped.
+func readCSV(dir, name string, required bool, fn func(get func(column string) string) error) error {
+	file, err := openCSV(dir, name, required)
+	if err != nil || file == nil {
+		return err
+	}
+	defer file.Close()
+
+	for {
+		if err := file.read(); errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := fn(file.get); err != nil {
+			return err
+		}
+	}
+}
+
+// csvFile reads a CSV file a row at a time, looking its columns up by
+// header name.
+type csvFile struct {
+	file    *os.File
+	name    string
+	r       *csv.Reader
+	columns map[string]int
+	row     []string
+}
+
+// openCSV opens a CSV file in dir and reads its header. A missing optional
+// file gives nil.
+func openCSV(dir, name string, required bool) (*csvFile, error) {
+	file, err := os.Open(filepath.Join(dir, name))
+	if errors.Is(err, os.ErrNotExist) && !required {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+
+	header, err := r.Read()
+	if err != nil {
+		file.Close()
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	columns := make(map[string]int, len(header))
+	for i, h := range header {
+		columns[strings.TrimPrefix(h, "\ufeff")] = i
+	}
+
+	return &csvFile{file: file, name: name, r: r, columns: columns}, nil
+}
+
+func (c *csvFile) Close() error {
+	return c.file.Close()
+}
+
+// read moves to the next row, returning io.EOF after the last.
+func (c *csvFile) read() error {
+	row, err := c.r.Read()
+	if errors.Is(err, io.EOF) {
+		return err
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", c.name, err)
+	}
+	c.row = row
+	return nil
+}
+
+func (c *csvFile) get(column string) string {
+	if i, ok := c.columns[column]; ok && i < len(c.row) {
+		return strings.TrimSpace(c.row[i])
+	}
+	return ""
+}
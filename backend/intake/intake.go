@@ -0,0 +1,155 @@
+// Package intake derives default nutrition goals from reference daily
+// intake tables, adjusted for a person's age, sex and weight when known.
+package intake
+
+import (
+	"math"
+
+	"myjunkpal/models"
+)
+
+// Sexes a profile can give; anything else counts as unknown.
+const (
+	Male   = "male"
+	Female = "female"
+)
+
+// The FDA Daily Values used on food labels, which assume 2000 kcal a day.
+// They are the defaults when nothing is known about a person, and carbs,
+// fats and sugar are scaled from them for other calorie needs.
+const (
+	dvCalories = 2000
+	dvProtein  = 50
+	dvCarbs    = 275
+	dvFats     = 78
+	dvSugar    = 50 // Added sugars, 10% of calories
+)
+
+// Adequate fiber intake is 14 g per 1000 kcal.
+const fiberPer1000kcal = 14
+
+// energyByAge is the estimated daily calorie need of a moderately active
+// person, from the Dietary Guidelines for Americans 2020-2025. Each row
+// applies from minAge up to the next row.
+var energyByAge = []struct {
+	minAge       int
+	male, female float64
+}{
+	{0, 1000, 1000},
+	{3, 1400, 1200},
+	{4, 1400, 1400},
+	{6, 1600, 1400},
+	{7, 1600, 1600},
+	{9, 1800, 1600},
+	{10, 1800, 1800},
+	{11, 2000, 1800},
+	{12, 2200, 2000},
+	{14, 2400, 2000},
+	{15, 2600, 2000},
+	{16, 2800, 2000},
+	{19, 2800, 2200},
+	{26, 2600, 2000},
+	{46, 2400, 2000},
+	{51, 2400, 1800},
+	{66, 2200, 1800},
+}
+
+// proteinByAge is the protein RDA per kg of body weight, and in grams for
+// a reference body weight when the weight isn't known.
+var proteinByAge = []struct {
+	minAge       int
+	perKg        float64
+	male, female float64
+}{
+	{0, 1.05, 13, 13},
+	{4, 0.95, 19, 19},
+	{9, 0.95, 34, 34},
+	{14, 0.85, 52, 46},
+	{19, 0.8, 56, 46},
+}
+
+// sodiumByAge is the adequate sodium intake in mg, and the intake above
+// which chronic disease risk goes up, used as the limit.
+var sodiumByAge = []struct {
+	minAge      int
+	goal, limit float64
+}{
+	{0, 800, 1200},
+	{4, 1000, 1500},
+	{9, 1200, 1800},
+	{14, 1500, 2300},
+}
+
+// adultAge stands in for an unknown age.
+const adultAge = 30
+
+// Goals returns the reference goals for a person. Age 0, an empty sex and
+// weight 0 mean unknown; with nothing known these are the Daily Values.
+func Goals(age int, sex string, weight float64) models.NutritionGoals {
+	known := age > 0 || sex == Male || sex == Female
+	if age <= 0 {
+		age = adultAge
+	}
+
+	calories := float64(dvCalories)
+	if known {
+		row := energyByAge[0]
+		for _, r := range energyByAge {
+			if age >= r.minAge {
+				row = r
+			}
+		}
+		// Rounded, as the averages for an unknown sex fall between rows
+		calories = math.Round(bySex(sex, row.male, row.female)/100) * 100
+	}
+
+	protein := proteinFor(age, sex, weight, known)
+
+	sodium := sodiumByAge[0]
+	for _, r := range sodiumByAge {
+		if age >= r.minAge {
+			sodium = r
+		}
+	}
+
+	scale := calories / dvCalories
+	return models.NutritionGoals{
+		DailyCalorieGoal: calories,
+		DailyProteinGoal: math.Round(protein),
+		DailyCarbsGoal:   math.Round(dvCarbs * scale),
+		DailyFatsGoal:    math.Round(dvFats * scale),
+		DailyFiberGoal:   math.Round(fiberPer1000kcal * calories / 1000),
+		DailySodiumGoal:  sodium.goal,
+		DailySodiumLimit: sodium.limit,
+		DailySugarLimit:  math.Round(dvSugar * scale),
+	}
+}
+
+func proteinFor(age int, sex string, weight float64, known bool) float64 {
+	row := proteinByAge[0]
+	for _, r := range proteinByAge {
+		if age >= r.minAge {
+			row = r
+		}
+	}
+
+	switch {
+	case weight > 0:
+		return row.perKg * weight
+	case known:
+		return bySex(sex, row.male, row.female)
+	default:
+		return dvProtein
+	}
+}
+
+// bySex picks the value for sex, or their average when it's unknown.
+func bySex(sex string, male, female float64) float64 {
+	switch sex {
+	case Male:
+		return male
+	case Female:
+		return female
+	}
+	return (male + female) / 2
+}
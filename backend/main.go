@@ -1,8 +1,12 @@
 package main
 
 import (
+	"crypto/rand"
+	"flag"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"myjunkpal/handlers"
 	"myjunkpal/middleware"
@@ -13,17 +17,66 @@ import (
 )
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			runMigrate(os.Args[2:])
+			return
+		case "import-foods":
+			runImportFoods(os.Args[2:])
+			return
+		case "migrate-categories":
+			runMigrateCategories(os.Args[2:])
+			return
+		}
+	}
+
+	tokenSecret := flag.String("token-secret", os.Getenv("MYJUNKPAL_TOKEN_SECRET"), "key used to sign auth tokens")
+	accessTTL := flag.Duration("access-ttl", 15*time.Minute, "lifetime of access tokens")
+	refreshTTL := flag.Duration("refresh-ttl", 30*24*time.Hour, "lifetime of refresh tokens")
+	storeKind := flag.String("store", "json", "storage backend: json or sqlite")
+	sqlitePath := flag.String("sqlite-path", "./data/myjunkpal.db", "database file for the sqlite store")
+	flag.Parse()
+
 	// Initialize storage
 	store := storage.NewJSONStore("./data")
 	if err := store.EnsureDataDir(); err != nil {
 		log.Fatal("Failed to create data directory:", err)
 	}
 
+	var repos *storage.Repositories
+	switch *storeKind {
+	case "json":
+		repos = storage.NewJSONRepositories(store)
+	case "sqlite":
+		db, err := storage.OpenSQLite(*sqlitePath)
+		if err != nil {
+			log.Fatal("Failed to open sqlite database:", err)
+		}
+		defer db.Close()
+		repos = storage.NewSQLiteRepositories(db)
+	default:
+		log.Fatalf("Unknown store %q, use json or sqlite", *storeKind)
+	}
+
+	// Initialize token signing
+	key := []byte(*tokenSecret)
+	if len(key) == 0 {
+		log.Println("No token secret configured, generating a random one; tokens will not survive a restart")
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			log.Fatal("Failed to generate token secret:", err)
+		}
+	}
+	tokens := handlers.NewTokenManager(repos.Tokens, key, *accessTTL, *refreshTTL)
+	auth := middleware.NewAuth(tokens, repos.Users)
+
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(store)
-	foodHandler := handlers.NewFoodHandler(store)
-	entryHandler := handlers.NewEntryHandler(store)
-	nutritionHandler := handlers.NewNutritionHandler(store)
+	authHandler := handlers.NewAuthHandler(repos.Users, tokens)
+	foodHandler := handlers.NewFoodHandler(repos.Foods, repos.Entries, repos.Favorites)
+	recipeHandler := handlers.NewRecipeHandler(repos.Foods)
+	entryHandler := handlers.NewEntryHandler(repos.Entries, repos.Foods)
+	nutritionHandler := handlers.NewNutritionHandler(repos.Entries, repos.Goals)
 
 	// Setup router
 	r := mux.NewRouter()
@@ -31,33 +84,56 @@ func main() {
 	// Auth routes (no auth required)
 	r.HandleFunc("/api/auth/register", authHandler.Register).Methods("POST")
 	r.HandleFunc("/api/auth/login", authHandler.Login).Methods("POST")
-	r.HandleFunc("/api/users/me", middleware.RequireAuth(authHandler.GetCurrentUser)).Methods("GET")
+	r.HandleFunc("/api/auth/refresh", authHandler.Refresh).Methods("POST")
+	r.HandleFunc("/api/auth/logout", authHandler.Logout).Methods("POST")
+	r.HandleFunc("/api/users/me", auth.RequireAuth(authHandler.GetCurrentUser)).Methods("GET")
+	r.HandleFunc("/api/users/me", auth.RequireAuth(authHandler.UpdateCurrentUser)).Methods("PUT")
 
 	// Food routes (auth required)
-	r.HandleFunc("/api/foods", middleware.RequireAuth(foodHandler.GetFoods)).Methods("GET")
-	r.HandleFunc("/api/foods/{id}", middleware.RequireAuth(foodHandler.GetFood)).Methods("GET")
-	r.HandleFunc("/api/foods", middleware.RequireAuth(foodHandler.CreateFood)).Methods("POST")
-	r.HandleFunc("/api/foods/{id}", middleware.RequireAuth(foodHandler.UpdateFood)).Methods("PUT")
-	r.HandleFunc("/api/foods/{id}", middleware.RequireAuth(foodHandler.DeleteFood)).Methods("DELETE")
+	r.HandleFunc("/api/foods", auth.RequireAuth(foodHandler.GetFoods)).Methods("GET")
+	r.HandleFunc("/api/foods/duplicates", auth.RequireAuth(foodHandler.GetDuplicates)).Methods("GET")
+	r.HandleFunc("/api/foods/favorites", auth.RequireAuth(foodHandler.GetFavorites)).Methods("GET")
+	r.HandleFunc("/api/foods/recent", auth.RequireAuth(foodHandler.GetRecentFoods)).Methods("GET")
+	r.HandleFunc("/api/foods/frequent", auth.RequireAuth(foodHandler.GetFrequentFoods)).Methods("GET")
+	r.HandleFunc("/api/foods/{id}", auth.RequireAuth(foodHandler.GetFood)).Methods("GET")
+	r.HandleFunc("/api/foods", auth.RequireAuth(foodHandler.CreateFood)).Methods("POST")
+	r.HandleFunc("/api/foods/barcode/{code}", auth.RequireAuth(foodHandler.GetFoodByBarcode)).Methods("GET")
+	r.HandleFunc("/api/foods/merge", auth.RequireAuth(foodHandler.MergeFoods)).Methods("POST")
+	r.HandleFunc("/api/foods/parse-ingredients", auth.RequireAuth(foodHandler.ParseIngredients)).Methods("POST")
+	r.HandleFunc("/api/foods/{id}", auth.RequireAuth(foodHandler.UpdateFood)).Methods("PUT")
+	r.HandleFunc("/api/foods/{id}", auth.RequireAuth(foodHandler.DeleteFood)).Methods("DELETE")
+	r.HandleFunc("/api/foods/{id}/history", auth.RequireAuth(foodHandler.GetFoodHistory)).Methods("GET")
+	r.HandleFunc("/api/foods/{id}/reapply", auth.RequireAuth(foodHandler.ReapplyFood)).Methods("POST")
+	r.HandleFunc("/api/foods/{id}/favorite", auth.RequireAuth(foodHandler.AddFavorite)).Methods("PUT")
+	r.HandleFunc("/api/foods/{id}/favorite", auth.RequireAuth(foodHandler.RemoveFavorite)).Methods("DELETE")
+	r.HandleFunc("/api/categories", auth.RequireAuth(foodHandler.GetCategories)).Methods("GET")
+
+	// Recipe routes (auth required); recipes are read and deleted through
+	// the food routes
+	r.HandleFunc("/api/recipes", auth.RequireAuth(recipeHandler.GetRecipes)).Methods("GET")
+	r.HandleFunc("/api/recipes", auth.RequireAuth(recipeHandler.CreateRecipe)).Methods("POST")
+	r.HandleFunc("/api/recipes/{id}", auth.RequireAuth(recipeHandler.UpdateRecipe)).Methods("PUT")
 
 	// Entry routes (auth required)
-	r.HandleFunc("/api/entries", middleware.RequireAuth(entryHandler.GetEntries)).Methods("GET")
-	r.HandleFunc("/api/entries/{id}", middleware.RequireAuth(entryHandler.GetEntry)).Methods("GET")
-	r.HandleFunc("/api/entries", middleware.RequireAuth(entryHandler.CreateEntry)).Methods("POST")
-	r.HandleFunc("/api/entries/{id}", middleware.RequireAuth(entryHandler.UpdateEntry)).Methods("PUT")
-	r.HandleFunc("/api/entries/{id}", middleware.RequireAuth(entryHandler.DeleteEntry)).Methods("DELETE")
+	r.HandleFunc("/api/entries", auth.RequireAuth(entryHandler.GetEntries)).Methods("GET")
+	r.HandleFunc("/api/entries/{id}", auth.RequireAuth(entryHandler.GetEntry)).Methods("GET")
+	r.HandleFunc("/api/entries", auth.RequireAuth(entryHandler.CreateEntry)).Methods("POST")
+	r.HandleFunc("/api/entries/{id}", auth.RequireAuth(entryHandler.UpdateEntry)).Methods("PUT")
+	r.HandleFunc("/api/entries/{id}", auth.RequireAuth(entryHandler.DeleteEntry)).Methods("DELETE")
 
 	// Nutrition routes (auth required)
-	r.HandleFunc("/api/nutrition/daily/{date}", middleware.RequireAuth(nutritionHandler.GetDailySummary)).Methods("GET")
-	r.HandleFunc("/api/nutrition/weekly", middleware.RequireAuth(nutritionHandler.GetWeeklySummary)).Methods("GET")
-	r.HandleFunc("/api/nutrition/goals", middleware.RequireAuth(nutritionHandler.GetGoals)).Methods("GET")
-	r.HandleFunc("/api/nutrition/goals", middleware.RequireAuth(nutritionHandler.UpdateGoals)).Methods("PUT")
+	r.HandleFunc("/api/nutrition/daily/{date}", auth.RequireAuth(nutritionHandler.GetDailySummary)).Methods("GET")
+	r.HandleFunc("/api/nutrition/weekly", auth.RequireAuth(nutritionHandler.GetWeeklySummary)).Methods("GET")
+	r.HandleFunc("/api/nutrition/goals", auth.RequireAuth(nutritionHandler.GetGoals)).Methods("GET")
+	r.HandleFunc("/api/nutrition/goals", auth.RequireAuth(nutritionHandler.UpdateGoals)).Methods("PUT")
+	r.HandleFunc("/api/nutrition/goals/defaults", auth.RequireAuth(nutritionHandler.GetDefaultGoals)).Methods("GET")
 
 	// Setup CORS
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "If-Match", "If-None-Match"},
+		ExposedHeaders:   []string{"ETag", "X-Total-Count"},
 		AllowCredentials: true,
 	})
 
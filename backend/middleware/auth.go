@@ -4,14 +4,35 @@ import (
 	"net/http"
 
 	"myjunkpal/handlers"
+	"myjunkpal/storage"
 )
 
-func RequireAuth(next http.HandlerFunc) http.HandlerFunc {
+type Auth struct {
+	tokens *handlers.TokenManager
+	users  storage.UserRepo
+}
+
+func NewAuth(tokens *handlers.TokenManager, users storage.UserRepo) *Auth {
+	return &Auth{tokens: tokens, users: users}
+}
+
+// RequireAuth validates the bearer access token in the Authorization header
+// and stores the user it was issued to on the request context.
+func (a *Auth) RequireAuth(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		if handlers.CurrentUser == nil {
+		claims, err := a.tokens.Validate(handlers.BearerToken(r), handlers.AccessToken)
+		if err != nil {
 			http.Error(w, "Unauthorized", http.StatusUnauthorized)
 			return
 		}
-		next(w, r)
+
+		// Load the user fresh so changes like updated goals are visible
+		user, err := a.users.GetUser(claims.Subject)
+		if err != nil {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r.WithContext(handlers.WithUser(r.Context(), user)))
 	}
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"myjunkpal/storage"
+)
+
+// runMigrate copies a JSON data directory into a SQL store:
+//
+//	myjunkpal migrate --from ./data --to sqlite://./data/myjunkpal.db
+func runMigrate(args []string) {
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	from := fs.String("from", "./data", "JSON data directory to read")
+	to := fs.String("to", "", "destination store, e.g. sqlite://./data/myjunkpal.db")
+	dryRun := fs.Bool("dry-run", false, "validate the source data without writing anything")
+	strict := fs.Bool("strict", false, "refuse to write if validation finds problems")
+	fs.Parse(args)
+
+	path, ok := strings.CutPrefix(*to, "sqlite://")
+	if !ok && !*dryRun {
+		log.Fatalf("Unsupported destination %q, use sqlite://<path>", *to)
+	}
+
+	if _, err := os.Stat(*from); err != nil {
+		log.Fatal("Cannot read source directory:", err)
+	}
+
+	snap, err := storage.LoadSnapshot(storage.NewJSONStore(*from))
+	if err != nil {
+		log.Fatal("Failed to read JSON data:", err)
+	}
+
+	fmt.Printf("Read %d users, %d foods, %d food revisions, %d entries, %d revoked tokens, %d favorites from %s\n",
+		len(snap.Users), len(snap.Foods), len(snap.FoodRevisions), len(snap.Entries),
+		len(snap.RevokedTokens), len(snap.Favorites), *from)
+
+	problems := snap.Validate()
+	for _, p := range problems {
+		fmt.Println("  problem:", p)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("Found %d referential integrity problems\n", len(problems))
+	} else {
+		fmt.Println("No referential integrity problems found")
+	}
+
+	if *dryRun {
+		return
+	}
+	if *strict && len(problems) > 0 {
+		log.Fatal("Not writing because of -strict")
+	}
+
+	db, err := storage.OpenSQLite(path)
+	if err != nil {
+		log.Fatal("Failed to open sqlite database:", err)
+	}
+	defer db.Close()
+
+	if err := storage.ImportSnapshot(db, snap); err != nil {
+		log.Fatal("Import failed, nothing was written:", err)
+	}
+
+	fmt.Println("Wrote everything to", path)
+}
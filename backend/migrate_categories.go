@@ -0,0 +1,97 @@
+package main
+
+import (
+	"cmp"
+	"flag"
+	"fmt"
+	"log"
+	"slices"
+
+	"myjunkpal/categories"
+	"myjunkpal/models"
+	"myjunkpal/storage"
+)
+
+// runMigrateCategories moves foods saved with free-text categories onto
+// the category tree, along with their past versions that entries may be
+// pinned to:
+//
+//	myjunkpal migrate-categories --to sqlite://./data/myjunkpal.db
+//	myjunkpal migrate-categories --to ./data --dry-run
+func runMigrateCategories(args []string) {
+	fs := flag.NewFlagSet("migrate-categories", flag.ExitOnError)
+	to := fs.String("to", "./data", "store to update: sqlite://<path> or a JSON data directory")
+	dryRun := fs.Bool("dry-run", false, "print how categories would change without writing anything")
+	fs.Parse(args)
+
+	loader, closeStore := openFoodLoader(*to)
+	defer closeStore()
+
+	type change struct{ from, to string }
+	changes := make(map[string]string)
+	counts := make(map[change]int)
+	err := loader.Foods(func(f *models.Food) {
+		if category := treeCategory(f); category != f.Category {
+			changes[f.ID] = category
+			counts[change{f.Category, category}]++
+		}
+	})
+	if err != nil {
+		log.Fatal("Failed to read foods:", err)
+	}
+	revisions := make(map[storage.FoodVersion]string)
+	err = loader.Revisions(func(f *models.Food) {
+		if category := treeCategory(f); category != f.Category {
+			revisions[storage.FoodVersion{ID: f.ID, Version: f.Version}] = category
+		}
+	})
+	if err != nil {
+		log.Fatal("Failed to read past versions of foods:", err)
+	}
+
+	var list []change
+	for c := range counts {
+		list = append(list, c)
+	}
+	slices.SortFunc(list, func(a, b change) int { return cmp.Or(cmp.Compare(a.from, b.from), cmp.Compare(a.to, b.to)) })
+	if len(list) > 0 {
+		fmt.Println("Categories to change, with their number of foods:")
+	}
+	for _, c := range list {
+		to := c.to
+		if to == "" {
+			to = "(none, no match)"
+		}
+		fmt.Printf("  %q -> %s: %d\n", c.from, to, counts[c])
+	}
+
+	if *dryRun {
+		fmt.Printf("Would recategorize %d foods and %d past versions\n", len(changes), len(revisions))
+		return
+	}
+	if len(changes) > 0 || len(revisions) > 0 {
+		if err := loader.SetCategories(changes, revisions); err != nil {
+			log.Fatal("Failed to update foods, nothing was written:", err)
+		}
+	}
+	fmt.Printf("Recategorized %d foods and %d past versions\n", len(changes), len(revisions))
+}
+
+// treeCategory returns the slug for a food's category: the category itself
+// if it's in the tree, else the closest match for it or, failing that, for
+// the food's name. Categories matching nothing are dropped.
+func treeCategory(f *models.Food) string {
+	if f.Category == "" {
+		return ""
+	}
+	if n, ok := categories.Lookup(f.Category); ok {
+		return n.Slug
+	}
+	if n, ok := categories.Match(f.Category); ok {
+		return n.Slug
+	}
+	if n, ok := categories.Match(f.Name); ok {
+		return n.Slug
+	}
+	return ""
+}
@@ -0,0 +1,10 @@
+package models
+
+// Category is a node of the food category tree. Foods store the Slug of
+// their category.
+type Category struct {
+	Slug     string     `json:"slug"`
+	Name     string     `json:"name"`
+	Path     []string   `json:"path"` // Slugs from the top-level category down to this one
+	Children []Category `json:"children,omitempty"`
+}
@@ -3,29 +3,49 @@ package models
 import "time"
 
 type Entry struct {
-	ID       string    `json:"id"`
-	UserID   string    `json:"user_id"`
-	FoodID   string    `json:"food_id"`
-	FoodName string    `json:"food_name"` // Denormalized for easy display
-	Quantity float64   `json:"quantity"`  // Number of servings
-	MealType string    `json:"meal_type"` // breakfast, lunch, dinner, snack
-	EatenAt  time.Time `json:"eaten_at"`
-	Calories float64   `json:"calories"` // Calculated: food.calories * quantity
-	Protein  float64   `json:"protein"`  // Calculated: food.protein * quantity
-	Carbs    float64   `json:"carbs"`    // Calculated: food.carbs * quantity
-	Fats     float64   `json:"fats"`     // Calculated: food.fats * quantity
-	CreatedAt time.Time `json:"created_at"`
+	ID          string    `json:"id"`
+	UserID      string    `json:"user_id"`
+	FoodID      string    `json:"food_id"`
+	FoodName    string    `json:"food_name"` // Denormalized for easy display
+	Quantity    float64   `json:"quantity"`  // Number of servings
+	MealType    string    `json:"meal_type"` // breakfast, lunch, dinner, snack
+	EatenAt     time.Time `json:"eaten_at"`
+	Calories    float64   `json:"calories"`         // Calculated: food.calories * quantity
+	Protein     float64   `json:"protein"`          // Calculated: food.protein * quantity
+	Carbs       float64   `json:"carbs"`            // Calculated: food.carbs * quantity
+	Fats        float64   `json:"fats"`             // Calculated: food.fats * quantity
+	Version     int       `json:"version"`          // Bumped on every update, used for ETags
+	FoodVersion int       `json:"food_version"`     // Food revision the nutrition was calculated from
+	Amount      float64   `json:"amount,omitempty"` // As logged when given in a unit, e.g. 150 g
+	Unit        string    `json:"unit,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// Calculated: food's micronutrients * quantity
+	Micronutrients
+}
+
+// EntryResponse is an entry as returned after logging it, with warnings
+// such as the food containing one of the user's allergens.
+type EntryResponse struct {
+	Entry
+	Warnings []FieldError `json:"warnings,omitempty"`
 }
 
+// Entries are logged either as Quantity servings or as Amount of Unit,
+// which is converted to servings of the food.
 type CreateEntryRequest struct {
 	FoodID   string  `json:"food_id"`
 	Quantity float64 `json:"quantity"`
+	Amount   float64 `json:"amount,omitempty"`
+	Unit     string  `json:"unit,omitempty"` // g, oz, cup, ... or one of the food's portions
 	MealType string  `json:"meal_type"`
 	EatenAt  string  `json:"eaten_at"` // ISO8601 format
 }
 
 type UpdateEntryRequest struct {
 	Quantity float64 `json:"quantity"`
+	Amount   float64 `json:"amount,omitempty"`
+	Unit     string  `json:"unit,omitempty"`
 	MealType string  `json:"meal_type"`
 	EatenAt  string  `json:"eaten_at"`
 }
@@ -37,11 +57,36 @@ type NutritionSummary struct {
 	Carbs    float64 `json:"carbs"`
 	Fats     float64 `json:"fats"`
 	Entries  []Entry `json:"entries"`
+
+	Micronutrients
+
+	// Daily summaries only: progress towards each nutrient the user has a
+	// target or limit for, keyed by nutrient (calories, protein, fiber, ...)
+	Progress map[string]NutrientProgress `json:"progress,omitempty"`
 }
 
+// NutritionGoals are a user's daily targets, plus upper limits for the
+// nutrients it's worth staying under. Zero means no target or limit.
 type NutritionGoals struct {
 	DailyCalorieGoal float64 `json:"daily_calorie_goal"`
 	DailyProteinGoal float64 `json:"daily_protein_goal"`
 	DailyCarbsGoal   float64 `json:"daily_carbs_goal"`
 	DailyFatsGoal    float64 `json:"daily_fats_goal"`
+	DailyFiberGoal   float64 `json:"daily_fiber_goal"`
+	DailyFiberLimit  float64 `json:"daily_fiber_limit"`
+	DailySodiumGoal  float64 `json:"daily_sodium_goal"`
+	DailySodiumLimit float64 `json:"daily_sodium_limit"`
+	DailySugarGoal   float64 `json:"daily_sugar_goal"`
+	DailySugarLimit  float64 `json:"daily_sugar_limit"`
+}
+
+// NutrientProgress compares a day's intake of one nutrient with the
+// user's goals for it.
+type NutrientProgress struct {
+	Amount    float64 `json:"amount"`
+	Target    float64 `json:"target,omitempty"`
+	Limit     float64 `json:"limit,omitempty"`
+	Percent   float64 `json:"percent_of_target"` // Of Target, or of Limit when there's no target
+	Deficit   bool    `json:"deficit"`           // Below Target
+	OverLimit bool    `json:"over_limit"`        // Above Limit
 }
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// Favorite marks a food the user wants at hand when logging.
+type Favorite struct {
+	UserID    string    `json:"user_id"`
+	FoodID    string    `json:"food_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// FoodUsage is a food with how the user has been logging it, as listed by
+// the favorite, recent and frequent food endpoints.
+type FoodUsage struct {
+	Food
+	Favorite    bool      `json:"favorite"`
+	Entries     int       `json:"entries"`                // Times logged
+	LastEatenAt time.Time `json:"last_eaten_at,omitzero"` // Zero if never logged
+	Score       float64   `json:"score,omitempty"`        // Frequency weighted by recency, for frequent foods
+}
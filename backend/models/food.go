@@ -12,28 +12,200 @@ type Food struct {
 	Fats        float64   `json:"fats"`
 	ServingSize float64   `json:"serving_size"`
 	ServingUnit string    `json:"serving_unit"` // g, ml, cup, etc
-	Category    string    `json:"category"`     // fruit, vegetable, protein, etc
+	Category    string    `json:"category"`     // Slug in the category tree, e.g. chicken; see package categories
+	Version     int       `json:"version"`      // Bumped on every update, used for ETags
 	CreatedAt   time.Time `json:"created_at"`
+	ArchivedAt  time.Time `json:"archived_at,omitzero"` // Set when deleted; archived foods are hidden from listings
+	Barcode     string    `json:"barcode,omitempty"`    // EAN-13, with UPC-A codes padded with a leading 0
+
+	// Optional labels. Tags are free-form; allergens and diets are from
+	// Allergens and Diets.
+	Tags      []string `json:"tags,omitempty"`
+	Allergens []string `json:"allergens,omitempty"` // What the food contains
+	Diets     []string `json:"diets,omitempty"`     // Diets the food suits
+
+	// Optional, per serving
+	Micronutrients
+
+	// Optional, for logging amounts in other units than ServingUnit
+	Density  float64   `json:"density,omitempty"`  // Grams per ml, converts between mass and volume
+	Portions []Portion `json:"portions,omitempty"` // e.g. 1 slice = 28 g
+
+	// Set for recipes, whose nutrition is derived from their ingredients
+	Ingredients []Ingredient `json:"ingredients,omitempty"`
+	Yield       *RecipeYield `json:"yield,omitempty"`
+}
+
+// Allergens are the allergens a food can declare: the fourteen that EU
+// labels must show, nuts meaning tree nuts.
+var Allergens = []string{"gluten", "shellfish", "egg", "fish", "peanuts", "soy", "dairy", "nuts",
+	"celery", "mustard", "sesame", "sulphites", "lupin", "molluscs"}
+
+// Diets are the dietary attributes a food can declare.
+var Diets = []string{"vegan", "vegetarian", "halal", "kosher"}
+
+// Portion is an alternate serving definition for a food: one Name is
+// Amount Unit, e.g. "slice" = 28 "g". Unit must be a unit of mass or
+// volume.
+type Portion struct {
+	Name   string  `json:"name"`
+	Amount float64 `json:"amount"`
+	Unit   string  `json:"unit"`
+}
+
+// Ingredient is one food in a recipe.
+type Ingredient struct {
+	FoodID   string  `json:"food_id"`
+	FoodName string  `json:"food_name"` // Denormalized for easy display
+	Quantity float64 `json:"quantity"`  // Number of servings of the food
+}
+
+// RecipeYield is how much a recipe makes, as either a number of servings
+// or a total cooked weight in grams.
+type RecipeYield struct {
+	Servings float64 `json:"servings,omitempty"`
+	Weight   float64 `json:"weight,omitempty"`
+}
+
+// IsRecipe reports whether the food is a recipe built from other foods.
+func (f *Food) IsRecipe() bool {
+	return len(f.Ingredients) > 0
+}
+
+// FoodRevision is a past version of a food, kept when the food is updated
+// so entries logged against it can still be recalculated from it.
+// ReplacedAt is empty for the current version in history listings.
+type FoodRevision struct {
+	Food
+	ReplacedAt time.Time `json:"replaced_at,omitzero"`
+}
+
+// ReapplyFoodResponse reports how many entries were moved to the latest
+// version of a food.
+type ReapplyFoodResponse struct {
+	FoodID  string `json:"food_id"`
+	Version int    `json:"version"`
+	Updated int    `json:"updated"`
+	Skipped int    `json:"skipped"` // Entries changed concurrently, left as they were
+}
+
+// FoodInUseResponse is the 409 body for a hard delete of a food that
+// entries or recipes still reference.
+type FoodInUseResponse struct {
+	Error   string `json:"error"`
+	FoodID  string `json:"food_id"`
+	Entries int    `json:"entries"`
+	Recipes int    `json:"recipes"`
+	Users   int    `json:"users"` // Users with entries for the food
+}
+
+// DuplicateGroup is a set of foods that look like the same food, by name
+// and nutrition.
+type DuplicateGroup struct {
+	TargetID string          `json:"target_id"` // Suggested food to merge the others into
+	Foods    []DuplicateFood `json:"foods"`
+}
+
+// DuplicateFood is a food in a DuplicateGroup with how often the user
+// logged it.
+type DuplicateFood struct {
+	Food
+	Entries int `json:"entries"`
+}
+
+// MergeFoodsRequest asks for the foods in FoodIDs to be merged into the
+// food TargetID.
+type MergeFoodsRequest struct {
+	TargetID string   `json:"target_id"`
+	FoodIDs  []string `json:"food_ids"`
+}
+
+// MergeFoodsResponse reports what a merge moved and deleted.
+type MergeFoodsResponse struct {
+	TargetID string   `json:"target_id"`
+	Merged   []string `json:"merged"`  // Foods deleted after moving everything onto the target
+	Skipped  []string `json:"skipped"` // Foods left archived because something changed mid-merge
+	Entries  int      `json:"entries"` // Entries moved onto the target
+	Recipes  int      `json:"recipes"` // Recipes now using the target
+}
+
+// FieldError is a problem with one field of a request, named as in its
+// JSON, e.g. "serving_size" or "portions[0].unit".
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationErrorResponse is the 422 body for a request with invalid
+// fields.
+type ValidationErrorResponse struct {
+	Error  string       `json:"error"`
+	Errors []FieldError `json:"errors"`
+}
+
+// FoodResponse is a food as returned after a save, with warnings about
+// values that look wrong but were saved anyway.
+type FoodResponse struct {
+	Food
+	Warnings []FieldError `json:"warnings,omitempty"`
 }
 
 type CreateFoodRequest struct {
-	Name        string  `json:"name"`
-	Calories    float64 `json:"calories"`
-	Protein     float64 `json:"protein"`
-	Carbs       float64 `json:"carbs"`
-	Fats        float64 `json:"fats"`
-	ServingSize float64 `json:"serving_size"`
-	ServingUnit string  `json:"serving_unit"`
-	Category    string  `json:"category"`
+	Name        string    `json:"name"`
+	Calories    float64   `json:"calories"`
+	Protein     float64   `json:"protein"`
+	Carbs       float64   `json:"carbs"`
+	Fats        float64   `json:"fats"`
+	ServingSize float64   `json:"serving_size"`
+	ServingUnit string    `json:"serving_unit"`
+	Category    string    `json:"category"`
+	Density     float64   `json:"density,omitempty"`
+	Portions    []Portion `json:"portions,omitempty"`
+	Barcode     string    `json:"barcode,omitempty"` // EAN-13 or UPC-A
+
+	Tags      []string `json:"tags,omitempty"`
+	Allergens []string `json:"allergens,omitempty"`
+	Diets     []string `json:"diets,omitempty"`
+
+	Micronutrients
+}
+
+type CreateRecipeRequest struct {
+	Name        string       `json:"name"`
+	Category    string       `json:"category"`
+	Ingredients []Ingredient `json:"ingredients"`
+	Yield       RecipeYield  `json:"yield"`
+	ServingSize float64      `json:"serving_size"` // Grams per serving for weight yields, default 100
+
+	Tags []string `json:"tags,omitempty"` // Allergens and diets come from the ingredients
+}
+
+type UpdateRecipeRequest struct {
+	Name        string       `json:"name"`
+	Category    string       `json:"category"`
+	Ingredients []Ingredient `json:"ingredients"`
+	Yield       RecipeYield  `json:"yield"`
+	ServingSize float64      `json:"serving_size"`
+
+	Tags []string `json:"tags,omitempty"` // Allergens and diets come from the ingredients
 }
 
 type UpdateFoodRequest struct {
-	Name        string  `json:"name"`
-	Calories    float64 `json:"calories"`
-	Protein     float64 `json:"protein"`
-	Carbs       float64 `json:"carbs"`
-	Fats        float64 `json:"fats"`
-	ServingSize float64 `json:"serving_size"`
-	ServingUnit string  `json:"serving_unit"`
-	Category    string  `json:"category"`
+	Name        string    `json:"name"`
+	Calories    float64   `json:"calories"`
+	Protein     float64   `json:"protein"`
+	Carbs       float64   `json:"carbs"`
+	Fats        float64   `json:"fats"`
+	ServingSize float64   `json:"serving_size"`
+	ServingUnit string    `json:"serving_unit"`
+	Category    string    `json:"category"`
+	Density     float64   `json:"density,omitempty"`
+	Portions    []Portion `json:"portions,omitempty"`
+	Barcode     string    `json:"barcode,omitempty"`
+
+	Tags      []string `json:"tags,omitempty"`
+	Allergens []string `json:"allergens,omitempty"`
+	Diets     []string `json:"diets,omitempty"`
+
+	Micronutrients
 }
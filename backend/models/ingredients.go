@@ -0,0 +1,40 @@
+package models
+
+type ParseIngredientsRequest struct {
+	Text string `json:"text"` // One ingredient per line, e.g. "200 g chicken breast"
+	Name string `json:"name"` // Name for the combined food, optional
+}
+
+// ParsedIngredient is one line of a pasted ingredient list and the food it
+// was matched to.
+type ParsedIngredient struct {
+	Line       string      `json:"line"`
+	Quantity   float64     `json:"quantity"`
+	Unit       string      `json:"unit"` // Empty when the quantity is a number of servings
+	Name       string      `json:"name"`
+	Matched    bool        `json:"matched"` // False when no food matched or the amount couldn't be converted
+	Food       *Food       `json:"food,omitempty"`
+	Confidence float64     `json:"confidence"` // 0 to 1
+	Servings   float64     `json:"servings"`   // Quantity converted to servings of Food
+	Calories   float64     `json:"calories"`
+	Protein    float64     `json:"protein"`
+	Carbs      float64     `json:"carbs"`
+	Fats       float64     `json:"fats"`
+	Problem    string      `json:"problem,omitempty"`
+	Candidates []FoodMatch `json:"candidates,omitempty"` // Next best matches
+
+	Micronutrients
+}
+
+type FoodMatch struct {
+	FoodID     string  `json:"food_id"`
+	Name       string  `json:"name"`
+	Confidence float64 `json:"confidence"`
+}
+
+type ParseIngredientsResponse struct {
+	Ingredients []ParsedIngredient `json:"ingredients"`
+	Unmatched   int                `json:"unmatched"`
+	// Summed nutrition of the matched lines, ready to POST to /api/foods
+	Food CreateFoodRequest `json:"food"`
+}
@@ -0,0 +1,88 @@
+package models
+
+// Micronutrients are the optional nutrients tracked beside the macros.
+// They are embedded in foods (per serving), entries and summaries, and a
+// zero value means unknown or none.
+type Micronutrients struct {
+	Fiber        float64 `json:"fiber,omitempty"`         // g
+	Sugar        float64 `json:"sugar,omitempty"`         // g
+	SaturatedFat float64 `json:"saturated_fat,omitempty"` // g
+	Sodium       float64 `json:"sodium,omitempty"`        // mg
+	Potassium    float64 `json:"potassium,omitempty"`     // mg
+	Cholesterol  float64 `json:"cholesterol,omitempty"`   // mg
+	VitaminA     float64 `json:"vitamin_a,omitempty"`     // µg RAE
+	VitaminC     float64 `json:"vitamin_c,omitempty"`     // mg
+	VitaminD     float64 `json:"vitamin_d,omitempty"`     // µg
+	VitaminB12   float64 `json:"vitamin_b12,omitempty"`   // µg
+	Calcium      float64 `json:"calcium,omitempty"`       // mg
+	Iron         float64 `json:"iron,omitempty"`          // mg
+	Magnesium    float64 `json:"magnesium,omitempty"`     // mg
+	Zinc         float64 `json:"zinc,omitempty"`          // mg
+}
+
+// Scale returns the micronutrients multiplied by factor, e.g. a food's
+// per-serving values for a number of servings.
+func (m Micronutrients) Scale(factor float64) Micronutrients {
+	return Micronutrients{
+		Fiber:        m.Fiber * factor,
+		Sugar:        m.Sugar * factor,
+		SaturatedFat: m.SaturatedFat * factor,
+		Sodium:       m.Sodium * factor,
+		Potassium:    m.Potassium * factor,
+		Cholesterol:  m.Cholesterol * factor,
+		VitaminA:     m.VitaminA * factor,
+		VitaminC:     m.VitaminC * factor,
+		VitaminD:     m.VitaminD * factor,
+		VitaminB12:   m.VitaminB12 * factor,
+		Calcium:      m.Calcium * factor,
+		Iron:         m.Iron * factor,
+		Magnesium:    m.Magnesium * factor,
+		Zinc:         m.Zinc * factor,
+	}
+}
+
+// Add returns the sum of two sets of micronutrients.
+func (m Micronutrients) Add(o Micronutrients) Micronutrients {
+	return Micronutrients{
+		Fiber:        m.Fiber + o.Fiber,
+		Sugar:        m.Sugar + o.Sugar,
+		SaturatedFat: m.SaturatedFat + o.SaturatedFat,
+		Sodium:       m.Sodium + o.Sodium,
+		Potassium:    m.Potassium + o.Potassium,
+		Cholesterol:  m.Cholesterol + o.Cholesterol,
+		VitaminA:     m.VitaminA + o.VitaminA,
+		VitaminC:     m.VitaminC + o.VitaminC,
+		VitaminD:     m.VitaminD + o.VitaminD,
+		VitaminB12:   m.VitaminB12 + o.VitaminB12,
+		Calcium:      m.Calcium + o.Calcium,
+		Iron:         m.Iron + o.Iron,
+		Magnesium:    m.Magnesium + o.Magnesium,
+		Zinc:         m.Zinc + o.Zinc,
+	}
+}
+
+// MicronutrientValue is one micronutrient, named as in JSON.
+type MicronutrientValue struct {
+	Name  string
+	Value float64
+}
+
+// Values returns every micronutrient, zero or not, in the order declared.
+func (m Micronutrients) Values() []MicronutrientValue {
+	return []MicronutrientValue{
+		{"fiber", m.Fiber},
+		{"sugar", m.Sugar},
+		{"saturated_fat", m.SaturatedFat},
+		{"sodium", m.Sodium},
+		{"potassium", m.Potassium},
+		{"cholesterol", m.Cholesterol},
+		{"vitamin_a", m.VitaminA},
+		{"vitamin_c", m.VitaminC},
+		{"vitamin_d", m.VitaminD},
+		{"vitamin_b12", m.VitaminB12},
+		{"calcium", m.Calcium},
+		{"iron", m.Iron},
+		{"magnesium", m.Magnesium},
+		{"zinc", m.Zinc},
+	}
+}
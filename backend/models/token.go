@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+type TokenClaims struct {
+	Subject   string `json:"sub"` // User ID
+	Type      string `json:"typ"` // access or refresh
+	ID        string `json:"jti"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+type RevokedToken struct {
+	ID        string    `json:"id"`
+	ExpiresAt time.Time `json:"expires_at"` // Safe to forget after this
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type LogoutRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
@@ -3,15 +3,21 @@ package models
 import "time"
 
 type User struct {
-	ID                string    `json:"id"`
-	Email             string    `json:"email"`
-	Name              string    `json:"name"`
-	Password          string    `json:"password"`
-	DailyCalorieGoal  float64   `json:"daily_calorie_goal"`
-	DailyProteinGoal  float64   `json:"daily_protein_goal"`
-	DailyCarbsGoal    float64   `json:"daily_carbs_goal"`
-	DailyFatsGoal     float64   `json:"daily_fats_goal"`
-	CreatedAt         time.Time `json:"created_at"`
+	ID        string    `json:"id"`
+	Email     string    `json:"email"`
+	Name      string    `json:"name"`
+	Password  string    `json:"password"`
+	CreatedAt time.Time `json:"created_at"`
+
+	// Optional profile, used to pick reference goals
+	Age    int     `json:"age,omitempty"`
+	Sex    string  `json:"sex,omitempty"`    // male or female
+	Weight float64 `json:"weight,omitempty"` // kg
+
+	// Logging a food with one of these gives a warning
+	Allergens []string `json:"allergens,omitempty"`
+
+	NutritionGoals
 }
 
 type LoginRequest struct {
@@ -20,7 +26,28 @@ type LoginRequest struct {
 }
 
 type RegisterRequest struct {
-	Email    string `json:"email"`
-	Name     string `json:"name"`
-	Password string `json:"password"`
+	Email    string  `json:"email"`
+	Name     string  `json:"name"`
+	Password string  `json:"password"`
+	Age      int     `json:"age,omitempty"`
+	Sex      string  `json:"sex,omitempty"`
+	Weight   float64 `json:"weight,omitempty"`
+}
+
+// UpdateProfileRequest sets the optional profile of the current user,
+// including the allergens to warn them about; fields left out keep their
+// value. It doesn't change their goals; see GET /api/nutrition/goals/defaults.
+type UpdateProfileRequest struct {
+	Age    *int     `json:"age"`
+	Sex    *string  `json:"sex"`
+	Weight *float64 `json:"weight"`
+
+	Allergens *[]string `json:"allergens"`
+}
+
+type AuthResponse struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"` // Access token expiry
+	User         User      `json:"user"`
 }
@@ -0,0 +1,115 @@
+package search
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"myjunkpal/models"
+)
+
+// Index maps the words in food names to the foods using them, and their
+// trigrams to the words, so Candidates can find the foods a query may
+// match without comparing it with every word. Stores build one per change
+// to their foods; it must be treated as read-only.
+type Index struct {
+	postings map[string][]string // Word to the IDs of the foods using it
+	words    []string            // Every word, sorted, for prefix lookups
+	grams    map[string][]int    // Trigram to indexes into words
+}
+
+// NewIndex indexes the names of foods.
+func NewIndex(foods []models.Food) *Index {
+	ix := &Index{
+		postings: make(map[string][]string),
+		grams:    make(map[string][]int),
+	}
+	for _, f := range foods {
+		for _, w := range Tokens(f.Name) {
+			if p := ix.postings[w]; len(p) == 0 || p[len(p)-1] != f.ID {
+				ix.postings[w] = append(p, f.ID)
+			}
+		}
+	}
+
+	ix.words = slices.Sorted(maps.Keys(ix.postings))
+	for i, w := range ix.words {
+		for _, g := range trigrams(w) {
+			ix.grams[g] = append(ix.grams[g], i)
+		}
+	}
+	return ix
+}
+
+// Candidates returns the IDs of the foods with a word similar to one of
+// query's: the same word, one starting with it or it starts with, or a
+// near miss. Score rates every other food 0 against query.
+func (ix *Index) Candidates(query []string) map[string]bool {
+	ids := make(map[string]bool)
+	for _, q := range query {
+		for w := range ix.similarWords(q) {
+			for _, id := range ix.postings[w] {
+				ids[id] = true
+			}
+		}
+	}
+	return ids
+}
+
+// similarWords returns the indexed words similar to q, looking prefixes up
+// in the sorted words and near misses through the trigrams they share.
+func (ix *Index) similarWords(q string) map[string]bool {
+	found := make(map[string]bool)
+	if _, ok := ix.postings[q]; ok {
+		found[q] = true
+	}
+
+	if len(q) >= 3 {
+		i, _ := slices.BinarySearch(ix.words, q)
+		for ; i < len(ix.words) && strings.HasPrefix(ix.words[i], q); i++ {
+			found[ix.words[i]] = true
+		}
+		for n := 3; n < len(q); n++ {
+			if _, ok := ix.postings[q[:n]]; ok {
+				found[q[:n]] = true
+			}
+		}
+	}
+
+	// Each edit changes at most 3 trigrams, so a word few enough edits
+	// away still has most of q's
+	grams := trigrams(q)
+	shared := make(map[int]int)
+	for _, g := range grams {
+		for _, i := range ix.grams[g] {
+			shared[i]++
+		}
+	}
+	n := utf8.RuneCountInString(q)
+	for i, count := range shared {
+		w := ix.words[i]
+		m := utf8.RuneCountInString(w)
+		edits := int(maxTypos * float64(max(n, m)))
+		if found[w] || max(n-m, m-n) > edits || count < len(grams)-3*edits {
+			continue
+		}
+		if similarity(q, w) > 0 {
+			found[w] = true
+		}
+	}
+	return found
+}
+
+// trigrams returns the distinct runs of three letters in w, padded so its
+// first and last letters start and end runs of their own.
+func trigrams(w string) []string {
+	r := []rune("^^" + w + "$$")
+	var grams []string
+	for i := 0; i+3 <= len(r); i++ {
+		if g := string(r[i : i+3]); !slices.Contains(grams, g) {
+			grams = append(grams, g)
+		}
+	}
+	return grams
+}
@@ -0,0 +1,120 @@
+// Package search compares typed food names with stored ones, tolerating
+// typos, plurals and partial words, and indexes the stored names so a
+// query is only compared with the foods sharing a word with it.
+package search
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Words that say nothing about which food is meant.
+var stopwords = map[string]bool{
+	"a": true, "an": true, "and": true, "of": true, "the": true, "with": true,
+	"fresh": true, "raw": true, "chopped": true, "diced": true, "sliced": true,
+	"minced": true, "large": true, "medium": true, "small": true,
+}
+
+// Tokens splits a food name into lowercase singular words, dropping
+// punctuation and stopwords, so "Chicken Breasts," and "chicken breast"
+// compare equal.
+func Tokens(s string) []string {
+	words := strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	tokens := words[:0]
+	for _, w := range words {
+		if !stopwords[w] {
+			tokens = append(tokens, Singular(w))
+		}
+	}
+	return tokens
+}
+
+// Singular strips a common English plural ending from a word, or from the
+// last word of a phrase: "berries" becomes "berry", "potatoes" "potato"
+// and "beans" "bean".
+func Singular(w string) string {
+	switch {
+	case len(w) > 4 && strings.HasSuffix(w, "ies"):
+		return w[:len(w)-3] + "y"
+	case len(w) > 4 && (strings.HasSuffix(w, "oes") || strings.HasSuffix(w, "ches") ||
+		strings.HasSuffix(w, "shes") || strings.HasSuffix(w, "sses") || strings.HasSuffix(w, "xes")):
+		return w[:len(w)-2]
+	case len(w) > 3 && strings.HasSuffix(w, "s") && !strings.HasSuffix(w, "ss"):
+		return w[:len(w)-1]
+	}
+	return w
+}
+
+// Score rates how well query matches a food name, from 0 to 1: the
+// average of how well the query's words are covered by the name and the
+// name's by the query, comparing each word with its closest counterpart
+// and tolerating typos and prefixes. So "white rice" prefers "White Rice"
+// to "Brown Rice", and "salmon fillets" still finds "Salmon".
+func Score(query, name []string) float64 {
+	if len(query) == 0 || len(name) == 0 {
+		return 0
+	}
+	return (Coverage(query, name) + Coverage(name, query)) / 2
+}
+
+// Coverage is the average similarity of each word in a to its closest
+// word in b.
+func Coverage(a, b []string) float64 {
+	var total float64
+	for _, x := range a {
+		var best float64
+		for _, y := range b {
+			best = max(best, similarity(x, y))
+		}
+		total += best
+	}
+	return total / float64(len(a))
+}
+
+// Words differing by a typo are similar when their edit distance is at
+// most this fraction of the longer one.
+const maxTypos = 0.25
+
+// similarity compares two words: 1 when equal, high when one is a prefix
+// of the other or they differ by a typo, and 0 otherwise.
+func similarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+
+	if len(a) >= 3 && len(b) >= 3 && (strings.HasPrefix(a, b) || strings.HasPrefix(b, a)) {
+		return 0.8
+	}
+
+	ra, rb := []rune(a), []rune(b)
+	longest := max(len(ra), len(rb))
+	score := 1 - float64(levenshtein(ra, rb))/float64(longest)
+	if score < 1-maxTypos {
+		return 0
+	}
+	return score
+}
+
+func levenshtein(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -0,0 +1,143 @@
+package search
+
+import (
+	"maps"
+	"slices"
+	"testing"
+
+	"myjunkpal/models"
+)
+
+func TestTokens(t *testing.T) {
+	tests := []struct {
+		s    string
+		want []string
+	}{
+		{"Chicken Breasts,", []string{"chicken", "breast"}},
+		{"chicken breast", []string{"chicken", "breast"}},
+		{"Fresh Blueberries", []string{"blueberry"}},
+		{"Rice (white, cooked)", []string{"rice", "white", "cooked"}},
+		{"2% Milk", []string{"2", "milk"}},
+		{"Crème Fraîche", []string{"crème", "fraîche"}},
+		{"The", nil},
+		{"", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			if got := Tokens(tt.s); !slices.Equal(got, tt.want) {
+				t.Errorf("Tokens(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSingular(t *testing.T) {
+	tests := []struct{ word, want string }{
+		{"berries", "berry"},
+		{"potatoes", "potato"},
+		{"peaches", "peach"},
+		{"radishes", "radish"},
+		{"molasses", "molass"},
+		{"boxes", "box"},
+		{"beans", "bean"},
+		{"eggs", "egg"},
+		{"pies", "pie"},
+		{"bass", "bass"},
+		{"gas", "gas"},
+		{"rice", "rice"},
+		{"oats", "oat"},
+	}
+
+	for _, tt := range tests {
+		if got := Singular(tt.word); got != tt.want {
+			t.Errorf("Singular(%q) = %q, want %q", tt.word, got, tt.want)
+		}
+	}
+}
+
+func TestScore(t *testing.T) {
+	tests := []struct {
+		query, better, worse string
+	}{
+		{"white rice", "White Rice", "Brown Rice"},
+		{"salmon fillets", "Salmon", "Tuna"},
+		{"brocoli", "Broccoli", "Cauliflower"},
+		{"chick breast", "Chicken Breast", "Chicken Thigh"},
+		{"milk", "Milk", "Whole Milk"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			q := Tokens(tt.query)
+			better, worse := Score(q, Tokens(tt.better)), Score(q, Tokens(tt.worse))
+			if better <= worse {
+				t.Errorf("Score(%q): %q = %g, want more than %q = %g", tt.query, tt.better, better, tt.worse, worse)
+			}
+		})
+	}
+}
+
+func TestSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"rice", "rice", true},
+		{"chick", "chicken", true},
+		{"brocoli", "broccoli", true},
+		{"yoghurt", "yogurt", true},
+		{"rice", "mike", false}, // Two edits are too many in four letters
+		{"ri", "rice", false},   // Prefixes need three letters
+		{"apple", "banana", false},
+	}
+
+	for _, tt := range tests {
+		if got := similarity(tt.a, tt.b) > 0; got != tt.want {
+			t.Errorf("similarity(%q, %q) > 0 = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// Candidates must find every food Score rates above 0, so a search limited
+// to them loses nothing.
+func TestCandidates(t *testing.T) {
+	names := []string{
+		"White Rice", "Brown Rice", "Rice Cakes", "Broccoli", "Cauliflower",
+		"Chicken Breast", "Chicken Thighs", "Chickpeas", "Salmon Fillet",
+		"Greek Yoghurt", "Yogurt Raisins", "Blueberries", "Strawberry Jam",
+		"Peanut Butter", "Butternut Squash", "Oat Milk", "Whole Milk", "2% Milk",
+	}
+	var foods []models.Food
+	for _, name := range names {
+		foods = append(foods, models.Food{ID: name, Name: name})
+	}
+	ix := NewIndex(foods)
+
+	queries := []string{
+		"rice", "ric", "brocoli", "chick", "chickens breast", "yogurt",
+		"yoghurts", "blueberry", "straw", "butter", "mlk", "milk 2", "salmon fillets",
+		"xyz", "",
+	}
+	for _, query := range queries {
+		t.Run(query, func(t *testing.T) {
+			q := Tokens(query)
+			want := make(map[string]bool)
+			for _, f := range foods {
+				if Score(q, Tokens(f.Name)) > 0 {
+					want[f.ID] = true
+				}
+			}
+
+			got := ix.Candidates(q)
+			for id := range want {
+				if !got[id] {
+					t.Errorf("Candidates(%q) is missing %q", query, id)
+				}
+			}
+			if len(want) == 0 && len(got) > 0 {
+				t.Errorf("Candidates(%q) = %v, want none", query, slices.Sorted(maps.Keys(got)))
+			}
+		})
+	}
+}
@@ -0,0 +1,236 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+
+	"myjunkpal/models"
+)
+
+// FoodLoader bulk loads imported system foods into a store, and bulk
+// edits stored foods.
+type FoodLoader interface {
+	// SystemFoods calls fn with every stored system food, archived or not,
+	// so an import can skip the ones it already has.
+	SystemFoods(fn func(f *models.Food)) error
+	// Foods calls fn with every stored food, system or custom, archived or
+	// not.
+	Foods(fn func(f *models.Food)) error
+	// Revisions calls fn with every stored past version of a food.
+	Revisions(fn func(f *models.Food)) error
+	// SetCategories sets the category of each food ID in foods and of each
+	// past version in revisions, in place: they keep their version, as for
+	// a schema change.
+	SetCategories(foods map[string]string, revisions map[FoodVersion]string) error
+	// Add stores a batch of foods, skipping any whose ID is already used.
+	Add(foods []models.Food) error
+	// Close writes anything still pending.
+	Close() error
+}
+
+// FoodVersion identifies one version of a food.
+type FoodVersion struct {
+	ID      string
+	Version int
+}
+
+// SQLiteFoodLoader writes each batch of foods in its own transaction.
+type SQLiteFoodLoader struct {
+	db *sql.DB
+}
+
+func NewSQLiteFoodLoader(db *sql.DB) *SQLiteFoodLoader {
+	return &SQLiteFoodLoader{db: db}
+}
+
+func (l *SQLiteFoodLoader) SystemFoods(fn func(f *models.Food)) error {
+	return l.query(`SELECT `+foodColumns+` FROM foods WHERE user_id = ''`, fn)
+}
+
+func (l *SQLiteFoodLoader) Foods(fn func(f *models.Food)) error {
+	return l.query(`SELECT `+foodColumns+` FROM foods`, fn)
+}
+
+func (l *SQLiteFoodLoader) Revisions(fn func(f *models.Food)) error {
+	return l.query(`SELECT `+foodColumns+` FROM food_revisions`, fn)
+}
+
+func (l *SQLiteFoodLoader) query(query string, fn func(f *models.Food)) error {
+	rows, err := l.db.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		f, err := scanFood(rows)
+		if err != nil {
+			return err
+		}
+		fn(f)
+	}
+	return rows.Err()
+}
+
+func (l *SQLiteFoodLoader) Add(foods []models.Food) error {
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`INSERT INTO foods (` + foodColumns + `) VALUES (` + placeholders(len(foodArgs(models.Food{}))) + `)
+	ON CONFLICT (id) DO NOTHING`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, f := range foods {
+		if _, err := stmt.Exec(foodArgs(f)...); err != nil {
+			return fmt.Errorf("food %s: %w", f.ID, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (l *SQLiteFoodLoader) SetCategories(foods map[string]string, revisions map[FoodVersion]string) error {
+	tx, err := l.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for id, category := range foods {
+		if _, err := tx.Exec(`UPDATE foods SET category = ? WHERE id = ?`, category, id); err != nil {
+			return fmt.Errorf("food %s: %w", id, err)
+		}
+	}
+	for rev, category := range revisions {
+		if _, err := tx.Exec(`UPDATE food_revisions SET category = ? WHERE id = ? AND version = ?`, category, rev.ID, rev.Version); err != nil {
+			return fmt.Errorf("food %s version %d: %w", rev.ID, rev.Version, err)
+		}
+	}
+	return tx.Commit()
+}
+
+func (l *SQLiteFoodLoader) Close() error {
+	return nil
+}
+
+// The JSON store rewrites foods.json whole on every save, so imports into
+// it are held in memory and written once, and stop at this many foods;
+// bigger catalogues need SQLite.
+const maxJSONFoods = 100000
+
+// JSONFoodLoader gathers the imported foods and appends them to foods.json
+// in one write on Close.
+type JSONFoodLoader struct {
+	store   *JSONStore
+	ids     map[string]bool // Stored and pending, loaded on the first Add
+	pending []models.Food
+}
+
+func NewJSONFoodLoader(store *JSONStore) *JSONFoodLoader {
+	return &JSONFoodLoader{store: store}
+}
+
+func (l *JSONFoodLoader) SystemFoods(fn func(f *models.Food)) error {
+	return l.Foods(func(f *models.Food) {
+		if f.UserID == "" {
+			fn(f)
+		}
+	})
+}
+
+func (l *JSONFoodLoader) Foods(fn func(f *models.Food)) error {
+	var foods []models.Food
+	if err := l.store.LoadFromFile("foods.json", &foods); err != nil {
+		return err
+	}
+	for i := range foods {
+		fn(&foods[i])
+	}
+	return nil
+}
+
+func (l *JSONFoodLoader) Revisions(fn func(f *models.Food)) error {
+	var revisions []models.FoodRevision
+	if err := l.store.LoadFromFile("food_revisions.json", &revisions); err != nil {
+		return err
+	}
+	for i := range revisions {
+		fn(&revisions[i].Food)
+	}
+	return nil
+}
+
+func (l *JSONFoodLoader) SetCategories(categories map[string]string, revisionCategories map[FoodVersion]string) error {
+	var foods []models.Food
+	var revisions []models.FoodRevision
+	files := map[string]interface{}{
+		"foods.json":          &foods,
+		"food_revisions.json": &revisions,
+	}
+	return l.store.UpdateFiles(files, func() error {
+		for i := range foods {
+			if category, ok := categories[foods[i].ID]; ok {
+				foods[i].Category = category
+			}
+		}
+		for i := range revisions {
+			rev := &revisions[i]
+			if category, ok := revisionCategories[FoodVersion{rev.ID, rev.Version}]; ok {
+				rev.Category = category
+			}
+		}
+		return nil
+	})
+}
+
+func (l *JSONFoodLoader) Add(batch []models.Food) error {
+	if l.ids == nil {
+		l.ids = make(map[string]bool)
+		if err := l.Foods(func(f *models.Food) { l.ids[f.ID] = true }); err != nil {
+			return err
+		}
+	}
+
+	for _, f := range batch {
+		if !l.ids[f.ID] {
+			l.pending = append(l.pending, f)
+			l.ids[f.ID] = true
+		}
+	}
+	if len(l.ids) > maxJSONFoods {
+		return errTooManyJSONFoods
+	}
+	return nil
+}
+
+var errTooManyJSONFoods = fmt.Errorf("the JSON store holds at most %d foods, import into SQLite with --to sqlite://<path>", maxJSONFoods)
+
+func (l *JSONFoodLoader) Close() error {
+	if len(l.pending) == 0 {
+		return nil
+	}
+
+	var foods []models.Food
+	err := l.store.Update("foods.json", &foods, func() error {
+		ids := make(map[string]bool, len(foods))
+		for _, f := range foods {
+			ids[f.ID] = true
+		}
+		for _, f := range l.pending {
+			if !ids[f.ID] {
+				foods = append(foods, f)
+			}
+		}
+		if len(foods) > maxJSONFoods {
+			return errTooManyJSONFoods
+		}
+		return nil
+	})
+	l.pending = nil
+	return err
+}
@@ -0,0 +1,117 @@
+package storage
+
+import "sync"
+
+// cachedFile keeps the decoded contents of one JSON file in memory along
+// with indexes built from it. Every read checks the file's modification
+// time and size, so edits made outside the server are picked up on the
+// next request; writes go through JSONStore.Update and refresh the cache.
+type cachedFile[T any, I any] struct {
+	store      *JSONStore
+	filename   string
+	buildIndex func(items []T) I
+
+	mu      sync.RWMutex
+	loaded  bool
+	version fileVersion
+	items   []T
+	index   I
+}
+
+func newCachedFile[T any, I any](store *JSONStore, filename string, buildIndex func([]T) I) *cachedFile[T, I] {
+	return &cachedFile[T, I]{
+		store:      store,
+		filename:   filename,
+		buildIndex: buildIndex,
+	}
+}
+
+// view returns the cached items and index, reloading them if the file has
+// changed on disk. Callers must treat both as read-only.
+func (c *cachedFile[T, I]) view() ([]T, I, error) {
+	// Stat before loading so the recorded version is never newer than the
+	// contents; at worst a concurrent edit triggers one extra reload
+	version, err := c.store.version(c.filename)
+	if err != nil {
+		var zero I
+		return nil, zero, err
+	}
+
+	c.mu.RLock()
+	if c.loaded && c.version == version {
+		defer c.mu.RUnlock()
+		return c.items, c.index, nil
+	}
+	c.mu.RUnlock()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var items []T
+	if err := c.store.LoadFromFile(c.filename, &items); err != nil {
+		var zero I
+		return nil, zero, err
+	}
+
+	c.set(items, version)
+	return c.items, c.index, nil
+}
+
+// update runs fn on the file's contents inside JSONStore.Update and caches
+// the saved result. If fn fails nothing is written and the cache is kept.
+func (c *cachedFile[T, I]) update(fn func(items *[]T) error) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var items []T
+	if err := c.store.Update(c.filename, &items, func() error {
+		return fn(&items)
+	}); err != nil {
+		return err
+	}
+
+	c.saved(items)
+	return nil
+}
+
+// updatePair is update for changes spanning two cached files, such as a
+// food and its history. Both are saved by one JSONStore.UpdateFiles call.
+// Callers must always pass a given pair of files in the same order.
+func updatePair[A, IA, B, IB any](a *cachedFile[A, IA], b *cachedFile[B, IB], fn func(a *[]A, b *[]B) error) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var as []A
+	var bs []B
+	files := map[string]interface{}{a.filename: &as, b.filename: &bs}
+	if err := a.store.UpdateFiles(files, func() error {
+		return fn(&as, &bs)
+	}); err != nil {
+		return err
+	}
+
+	a.saved(as)
+	b.saved(bs)
+	return nil
+}
+
+// saved caches items just written to the file. If the file can't be
+// stat'ed the cache is dropped and the next view reloads it.
+func (c *cachedFile[T, I]) saved(items []T) {
+	version, err := c.store.version(c.filename)
+	if err != nil {
+		c.loaded = false
+		return
+	}
+
+	c.set(items, version)
+}
+
+func (c *cachedFile[T, I]) set(items []T, version fileVersion) {
+	c.items = items
+	c.index = c.buildIndex(items)
+	c.version = version
+	c.loaded = true
+}
@@ -0,0 +1,196 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+
+	"myjunkpal/models"
+)
+
+// Snapshot is the full contents of a JSON data directory.
+type Snapshot struct {
+	Users         []models.User
+	Foods         []models.Food
+	FoodRevisions []models.FoodRevision
+	Entries       []models.Entry
+	RevokedTokens []models.RevokedToken
+	Favorites     []models.Favorite
+}
+
+// LoadSnapshot reads every collection from the JSON store.
+func LoadSnapshot(store *JSONStore) (*Snapshot, error) {
+	var snap Snapshot
+
+	files := []struct {
+		name string
+		v    interface{}
+	}{
+		{"users.json", &snap.Users},
+		{"foods.json", &snap.Foods},
+		{"food_revisions.json", &snap.FoodRevisions},
+		{"entries.json", &snap.Entries},
+		{"revoked_tokens.json", &snap.RevokedTokens},
+		{"favorites.json", &snap.Favorites},
+	}
+
+	for _, f := range files {
+		if err := store.LoadFromFile(f.name, f.v); err != nil {
+			return nil, fmt.Errorf("read %s: %w", f.name, err)
+		}
+	}
+
+	return &snap, nil
+}
+
+// Validate reports duplicate IDs and emails and references to users or
+// foods that don't exist in the snapshot.
+func (s *Snapshot) Validate() []string {
+	var problems []string
+
+	users := make(map[string]bool)
+	emails := make(map[string]string)
+	for _, u := range s.Users {
+		if users[u.ID] {
+			problems = append(problems, fmt.Sprintf("user %s: duplicate id", u.ID))
+		}
+		users[u.ID] = true
+
+		if other, ok := emails[u.Email]; ok && other != u.ID {
+			problems = append(problems, fmt.Sprintf("user %s: email %q already used by user %s", u.ID, u.Email, other))
+		}
+		emails[u.Email] = u.ID
+	}
+
+	foods := make(map[string]bool)
+	for _, f := range s.Foods {
+		if foods[f.ID] {
+			problems = append(problems, fmt.Sprintf("food %s: duplicate id", f.ID))
+		}
+		foods[f.ID] = true
+
+		if f.UserID != "" && !users[f.UserID] {
+			problems = append(problems, fmt.Sprintf("food %s (%s): owned by missing user %s", f.ID, f.Name, f.UserID))
+		}
+	}
+
+	// Ingredients can appear before or after their recipe, so check them
+	// once every food is known
+	for _, f := range s.Foods {
+		for _, ing := range f.Ingredients {
+			if !foods[ing.FoodID] {
+				problems = append(problems, fmt.Sprintf("recipe %s (%s): ingredient %s (%s) is missing", f.ID, f.Name, ing.FoodID, ing.FoodName))
+			}
+		}
+	}
+
+	entries := make(map[string]bool)
+	for _, e := range s.Entries {
+		if entries[e.ID] {
+			problems = append(problems, fmt.Sprintf("entry %s: duplicate id", e.ID))
+		}
+		entries[e.ID] = true
+
+		if !users[e.UserID] {
+			problems = append(problems, fmt.Sprintf("entry %s: belongs to missing user %s", e.ID, e.UserID))
+		}
+		if !foods[e.FoodID] {
+			problems = append(problems, fmt.Sprintf("entry %s: references missing food %s (%s)", e.ID, e.FoodID, e.FoodName))
+		}
+	}
+
+	for _, f := range s.Favorites {
+		if !users[f.UserID] {
+			problems = append(problems, fmt.Sprintf("favorite %s: belongs to missing user %s", f.FoodID, f.UserID))
+		}
+		if !foods[f.FoodID] {
+			problems = append(problems, fmt.Sprintf("favorite of user %s: references missing food %s", f.UserID, f.FoodID))
+		}
+	}
+
+	return problems
+}
+
+// ImportSnapshot writes the snapshot into a migrated SQLite database in a
+// single transaction. Rows are upserted by ID, so running the import again
+// with the same data leaves the database unchanged.
+func ImportSnapshot(db *sql.DB, snap *Snapshot) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, u := range snap.Users {
+		args := userArgs(u)
+		if _, err := tx.Exec(`INSERT INTO users (`+userColumns+`) VALUES (`+placeholders(len(args))+`)
+	ON CONFLICT (id) DO UPDATE SET email = excluded.email, name = excluded.name,
+	password = excluded.password, created_at = excluded.created_at, age = excluded.age,
+	sex = excluded.sex, weight = excluded.weight, allergens = excluded.allergens,
+	daily_calorie_goal = excluded.daily_calorie_goal,
+	daily_protein_goal = excluded.daily_protein_goal, daily_carbs_goal = excluded.daily_carbs_goal,
+	daily_fats_goal = excluded.daily_fats_goal, daily_fiber_goal = excluded.daily_fiber_goal,
+	daily_fiber_limit = excluded.daily_fiber_limit, daily_sodium_goal = excluded.daily_sodium_goal,
+	daily_sodium_limit = excluded.daily_sodium_limit, daily_sugar_goal = excluded.daily_sugar_goal,
+	daily_sugar_limit = excluded.daily_sugar_limit`,
+			args...); err != nil {
+			return fmt.Errorf("user %s: %w", u.ID, err)
+		}
+	}
+
+	for _, f := range snap.Foods {
+		args := foodArgs(f)
+		if _, err := tx.Exec(`INSERT INTO foods (`+foodColumns+`) VALUES (`+placeholders(len(args))+`)
+	ON CONFLICT (id) DO UPDATE SET user_id = excluded.user_id, name = excluded.name,
+	calories = excluded.calories, protein = excluded.protein, carbs = excluded.carbs,
+	fats = excluded.fats, serving_size = excluded.serving_size,
+	serving_unit = excluded.serving_unit, category = excluded.category,
+	version = excluded.version, created_at = excluded.created_at,
+	archived_at = excluded.archived_at, ingredients = excluded.ingredients,
+	yield_servings = excluded.yield_servings, yield_weight = excluded.yield_weight,
+	density = excluded.density, portions = excluded.portions,
+	micronutrients = excluded.micronutrients, barcode = excluded.barcode,
+	tags = excluded.tags, allergens = excluded.allergens, diets = excluded.diets`,
+			args...); err != nil {
+			return fmt.Errorf("food %s: %w", f.ID, err)
+		}
+	}
+
+	for _, rev := range snap.FoodRevisions {
+		args := append(foodArgs(rev.Food), formatTime(rev.ReplacedAt))
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO food_revisions (`+foodColumns+`, replaced_at)
+	VALUES (`+placeholders(len(args))+`)`, args...); err != nil {
+			return fmt.Errorf("food %s revision %d: %w", rev.ID, rev.Version, err)
+		}
+	}
+
+	for _, e := range snap.Entries {
+		args := entryArgs(e)
+		if _, err := tx.Exec(`INSERT INTO entries (`+entryColumns+`) VALUES (`+placeholders(len(args))+`)
+	ON CONFLICT (id) DO UPDATE SET user_id = excluded.user_id, food_id = excluded.food_id,
+	food_name = excluded.food_name, quantity = excluded.quantity, meal_type = excluded.meal_type,
+	eaten_at = excluded.eaten_at, eaten_at_offset = excluded.eaten_at_offset,
+	calories = excluded.calories, protein = excluded.protein, carbs = excluded.carbs,
+	fats = excluded.fats, version = excluded.version, food_version = excluded.food_version,
+	created_at = excluded.created_at, amount = excluded.amount, unit = excluded.unit,
+	micronutrients = excluded.micronutrients`,
+			args...); err != nil {
+			return fmt.Errorf("entry %s: %w", e.ID, err)
+		}
+	}
+
+	for _, t := range snap.RevokedTokens {
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO revoked_tokens (id, expires_at) VALUES (?, ?)`,
+			t.ID, t.ExpiresAt.Unix()); err != nil {
+			return fmt.Errorf("revoked token %s: %w", t.ID, err)
+		}
+	}
+
+	for _, f := range snap.Favorites {
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO favorites (user_id, food_id, created_at) VALUES (?, ?, ?)`,
+			f.UserID, f.FoodID, f.CreatedAt.UnixNano()); err != nil {
+			return fmt.Errorf("favorite %s of user %s: %w", f.FoodID, f.UserID, err)
+		}
+	}
+
+	return tx.Commit()
+}
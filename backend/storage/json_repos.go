@@ -0,0 +1,621 @@
+package storage
+
+import (
+	"errors"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"myjunkpal/models"
+	"myjunkpal/search"
+)
+
+// NewJSONRepositories returns repositories backed by the JSON files in the
+// store's data directory, using the same on-disk format as before the
+// repository interfaces were introduced. Each file is cached in memory
+// with indexes; see cachedFile.
+func NewJSONRepositories(store *JSONStore) *Repositories {
+	users := &JSONUserRepo{
+		cache: newCachedFile(store, "users.json", buildUserIndex),
+	}
+	entries := newCachedFile(store, "entries.json", buildEntryIndex)
+
+	return &Repositories{
+		Users: users,
+		Foods: &JSONFoodRepo{
+			cache:     newCachedFile(store, "foods.json", buildFoodIndex),
+			revisions: newCachedFile(store, "food_revisions.json", buildRevisionIndex),
+			entries:   entries,
+		},
+		Entries: &JSONEntryRepo{cache: entries},
+		Goals:   &JSONGoalRepo{users: users},
+		Tokens: &JSONTokenRepo{
+			cache: newCachedFile(store, "revoked_tokens.json", buildTokenIndex),
+		},
+		Favorites: &JSONFavoriteRepo{
+			cache: newCachedFile(store, "favorites.json", buildFavoriteIndex),
+		},
+	}
+}
+
+// dayKey formats t as the UTC calendar day used by the entry index.
+func dayKey(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+type userIndex struct {
+	byID    map[string]int
+	byEmail map[string]int
+}
+
+func buildUserIndex(users []models.User) userIndex {
+	idx := userIndex{
+		byID:    make(map[string]int, len(users)),
+		byEmail: make(map[string]int, len(users)),
+	}
+	for i, u := range users {
+		idx.byID[u.ID] = i
+		if _, dup := idx.byEmail[u.Email]; !dup {
+			idx.byEmail[u.Email] = i
+		}
+	}
+	return idx
+}
+
+type JSONUserRepo struct {
+	cache *cachedFile[models.User, userIndex]
+}
+
+func (r *JSONUserRepo) GetUser(id string) (*models.User, error) {
+	users, idx, err := r.cache.view()
+	if err != nil {
+		return nil, err
+	}
+
+	i, ok := idx.byID[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	u := users[i]
+	u.Allergens = slices.Clone(u.Allergens)
+	return &u, nil
+}
+
+func (r *JSONUserRepo) GetUserByEmail(email string) (*models.User, error) {
+	users, idx, err := r.cache.view()
+	if err != nil {
+		return nil, err
+	}
+
+	i, ok := idx.byEmail[email]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	u := users[i]
+	u.Allergens = slices.Clone(u.Allergens)
+	return &u, nil
+}
+
+func (r *JSONUserRepo) CreateUser(user models.User) error {
+	return r.cache.update(func(users *[]models.User) error {
+		*users = append(*users, user)
+		return nil
+	})
+}
+
+func (r *JSONUserRepo) UpdateUser(user models.User) error {
+	return r.update(user.ID, func(u *models.User) {
+		*u = user
+	})
+}
+
+// update applies fn to the user with the given ID under the store's lock.
+func (r *JSONUserRepo) update(id string, fn func(u *models.User)) error {
+	return r.cache.update(func(users *[]models.User) error {
+		for i := range *users {
+			if (*users)[i].ID == id {
+				fn(&(*users)[i])
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+}
+
+type foodIndex struct {
+	byID         map[string]int
+	byUser       map[string][]int // "" holds system foods
+	byIngredient map[string][]int // Recipes by the foods they contain
+	byBarcode    map[string][]int
+
+	names func() *search.Index // Built on the first search
+}
+
+func buildFoodIndex(foods []models.Food) foodIndex {
+	idx := foodIndex{
+		byID:         make(map[string]int, len(foods)),
+		byUser:       make(map[string][]int),
+		byIngredient: make(map[string][]int),
+		byBarcode:    make(map[string][]int),
+	}
+	for i, f := range foods {
+		if f.Barcode != "" {
+			idx.byBarcode[f.Barcode] = append(idx.byBarcode[f.Barcode], i)
+		}
+		idx.byID[f.ID] = i
+		idx.byUser[f.UserID] = append(idx.byUser[f.UserID], i)
+		for _, ing := range f.Ingredients {
+			idx.byIngredient[ing.FoodID] = append(idx.byIngredient[ing.FoodID], i)
+		}
+	}
+	idx.names = sync.OnceValue(func() *search.Index { return search.NewIndex(foods) })
+	return idx
+}
+
+// buildRevisionIndex maps food IDs to their revisions in file order,
+// which is the order they were replaced in.
+func buildRevisionIndex(revisions []models.FoodRevision) map[string][]int {
+	idx := make(map[string][]int)
+	for i, rev := range revisions {
+		idx[rev.ID] = append(idx[rev.ID], i)
+	}
+	return idx
+}
+
+// cloneFood copies the parts of a cached food that are shared by
+// reference, so callers can modify what they get back.
+func cloneFood(f models.Food) models.Food {
+	f.Ingredients = slices.Clone(f.Ingredients)
+	f.Portions = slices.Clone(f.Portions)
+	f.Tags = slices.Clone(f.Tags)
+	f.Allergens = slices.Clone(f.Allergens)
+	f.Diets = slices.Clone(f.Diets)
+	if f.Yield != nil {
+		yield := *f.Yield
+		f.Yield = &yield
+	}
+	return f
+}
+
+// JSONFoodRepo locks entries.json before foods.json before
+// food_revisions.json when it changes more than one.
+type JSONFoodRepo struct {
+	cache     *cachedFile[models.Food, foodIndex]
+	revisions *cachedFile[models.FoodRevision, map[string][]int]
+	entries   *cachedFile[models.Entry, entryIndex] // Shared with JSONEntryRepo
+}
+
+func (r *JSONFoodRepo) GetFood(id string) (*models.Food, error) {
+	foods, idx, err := r.cache.view()
+	if err != nil {
+		return nil, err
+	}
+
+	i, ok := idx.byID[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	f := cloneFood(foods[i])
+	return &f, nil
+}
+
+func (r *JSONFoodRepo) GetFoodRevision(id string, version int) (*models.Food, error) {
+	food, err := r.GetFood(id)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	if food != nil && food.Version == version {
+		return food, nil
+	}
+
+	history, err := r.FoodHistory(id)
+	if err != nil {
+		return nil, err
+	}
+	for _, rev := range history {
+		if rev.Version == version {
+			return &rev.Food, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *JSONFoodRepo) FoodHistory(id string) ([]models.FoodRevision, error) {
+	revisions, idx, err := r.revisions.view()
+	if err != nil {
+		return nil, err
+	}
+
+	var history []models.FoodRevision
+	for _, i := range idx[id] {
+		rev := revisions[i]
+		rev.Food = cloneFood(rev.Food)
+		history = append(history, rev)
+	}
+	return history, nil
+}
+
+func (r *JSONFoodRepo) RecipesUsing(foodID string) ([]models.Food, error) {
+	foods, idx, err := r.cache.view()
+	if err != nil {
+		return nil, err
+	}
+
+	var recipes []models.Food
+	for n, i := range idx.byIngredient[foodID] {
+		// A recipe listing the food twice is indexed twice
+		if n > 0 && idx.byIngredient[foodID][n-1] == i {
+			continue
+		}
+		recipes = append(recipes, cloneFood(foods[i]))
+	}
+	return recipes, nil
+}
+
+func (r *JSONFoodRepo) FoodsWithBarcode(barcode, userID string) ([]models.Food, error) {
+	foods, idx, err := r.cache.view()
+	if err != nil {
+		return nil, err
+	}
+
+	var custom, system []models.Food
+	for _, i := range idx.byBarcode[barcode] {
+		f := foods[i]
+		switch {
+		case !f.ArchivedAt.IsZero():
+		case f.UserID == "":
+			system = append(system, cloneFood(f))
+		case f.UserID == userID:
+			custom = append(custom, cloneFood(f))
+		}
+	}
+	return append(custom, system...), nil
+}
+
+func (r *JSONFoodRepo) SearchIndex() (*search.Index, error) {
+	_, idx, err := r.cache.view()
+	if err != nil {
+		return nil, err
+	}
+	return idx.names(), nil
+}
+
+func (r *JSONFoodRepo) FoodsVisibleTo(userID string) ([]models.Food, error) {
+	foods, idx, err := r.cache.view()
+	if err != nil {
+		return nil, err
+	}
+
+	// Merge system and custom foods back into file order
+	positions := append([]int(nil), idx.byUser[""]...)
+	if userID != "" {
+		positions = append(positions, idx.byUser[userID]...)
+	}
+	sort.Ints(positions)
+
+	var visible []models.Food
+	for _, i := range positions {
+		if foods[i].ArchivedAt.IsZero() {
+			visible = append(visible, cloneFood(foods[i]))
+		}
+	}
+	return visible, nil
+}
+
+func (r *JSONFoodRepo) CreateFood(food models.Food) error {
+	return r.cache.update(func(foods *[]models.Food) error {
+		*foods = append(*foods, food)
+		return nil
+	})
+}
+
+func (r *JSONFoodRepo) UpdateFood(food models.Food) error {
+	return updatePair(r.cache, r.revisions, func(foods *[]models.Food, revisions *[]models.FoodRevision) error {
+		for i, f := range *foods {
+			if f.ID == food.ID {
+				if f.Version != food.Version {
+					return ErrVersionConflict
+				}
+				*revisions = append(*revisions, models.FoodRevision{Food: f, ReplacedAt: time.Now()})
+				food.Version++
+				(*foods)[i] = food
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+}
+
+func (r *JSONFoodRepo) DeleteFood(id string, version int) error {
+	_, err := r.removeFood(id, version, nil)
+	return err
+}
+
+func (r *JSONFoodRepo) ReplaceFood(id string, version int, move func(entry *models.Entry)) (int, error) {
+	return r.removeFood(id, version, move)
+}
+
+// removeFood deletes the food from foods.json, first moving its entries
+// with move or, if move is nil, failing with ErrInUse when it has any.
+// Both files are locked throughout so no entry can be logged against the
+// food in between.
+func (r *JSONFoodRepo) removeFood(id string, version int, move func(entry *models.Entry)) (int, error) {
+	moved := 0
+	err := updatePair(r.entries, r.cache, func(entries *[]models.Entry, foods *[]models.Food) error {
+		for _, f := range *foods {
+			for _, ing := range f.Ingredients {
+				if ing.FoodID == id {
+					return ErrInUse
+				}
+			}
+		}
+
+		i := slices.IndexFunc(*foods, func(f models.Food) bool { return f.ID == id })
+		if i < 0 {
+			return ErrNotFound
+		}
+		if (*foods)[i].Version != version {
+			return ErrVersionConflict
+		}
+
+		for j := range *entries {
+			if e := &(*entries)[j]; e.FoodID == id {
+				if move == nil {
+					return ErrInUse
+				}
+				move(e)
+				e.Version++
+				moved++
+			}
+		}
+
+		*foods = slices.Delete(*foods, i, i+1)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return moved, nil
+}
+
+type userDay struct {
+	userID string
+	day    string // UTC date, see dayKey
+}
+
+type entryIndex struct {
+	byID      map[string]int
+	byUser    map[string][]int
+	byUserDay map[userDay][]int
+	byFood    map[string][]int
+}
+
+func buildEntryIndex(entries []models.Entry) entryIndex {
+	idx := entryIndex{
+		byID:      make(map[string]int, len(entries)),
+		byUser:    make(map[string][]int),
+		byUserDay: make(map[userDay][]int),
+		byFood:    make(map[string][]int),
+	}
+	for i, e := range entries {
+		idx.byID[e.ID] = i
+		idx.byUser[e.UserID] = append(idx.byUser[e.UserID], i)
+		key := userDay{userID: e.UserID, day: dayKey(e.EatenAt)}
+		idx.byUserDay[key] = append(idx.byUserDay[key], i)
+		idx.byFood[e.FoodID] = append(idx.byFood[e.FoodID], i)
+	}
+	return idx
+}
+
+type JSONEntryRepo struct {
+	cache *cachedFile[models.Entry, entryIndex]
+}
+
+func (r *JSONEntryRepo) GetEntry(id string) (*models.Entry, error) {
+	entries, idx, err := r.cache.view()
+	if err != nil {
+		return nil, err
+	}
+
+	i, ok := idx.byID[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	e := entries[i]
+	return &e, nil
+}
+
+func (r *JSONEntryRepo) EntriesForUser(userID string) ([]models.Entry, error) {
+	return r.EntriesForUserInRange(userID, time.Time{}, time.Time{})
+}
+
+func (r *JSONEntryRepo) EntriesForFood(foodID string) ([]models.Entry, error) {
+	entries, idx, err := r.cache.view()
+	if err != nil {
+		return nil, err
+	}
+
+	var matched []models.Entry
+	for _, i := range idx.byFood[foodID] {
+		matched = append(matched, entries[i])
+	}
+	return matched, nil
+}
+
+func (r *JSONEntryRepo) EntriesForUserInRange(userID string, start, end time.Time) ([]models.Entry, error) {
+	entries, idx, err := r.cache.view()
+	if err != nil {
+		return nil, err
+	}
+
+	// Bounded ranges only need to look at the days they cover
+	var positions []int
+	if start.IsZero() || end.IsZero() {
+		positions = idx.byUser[userID]
+	} else {
+		for day := start.UTC().Truncate(24 * time.Hour); day.Before(end); day = day.Add(24 * time.Hour) {
+			positions = append(positions, idx.byUserDay[userDay{userID: userID, day: dayKey(day)}]...)
+		}
+		sort.Ints(positions)
+	}
+
+	var matched []models.Entry
+	for _, i := range positions {
+		e := entries[i]
+		if !start.IsZero() && e.EatenAt.Before(start) {
+			continue
+		}
+		if !end.IsZero() && !e.EatenAt.Before(end) {
+			continue
+		}
+		matched = append(matched, e)
+	}
+	return matched, nil
+}
+
+func (r *JSONEntryRepo) CreateEntry(entry models.Entry) error {
+	return r.cache.update(func(entries *[]models.Entry) error {
+		*entries = append(*entries, entry)
+		return nil
+	})
+}
+
+func (r *JSONEntryRepo) UpdateEntry(entry models.Entry) error {
+	return r.cache.update(func(entries *[]models.Entry) error {
+		for i, e := range *entries {
+			if e.ID == entry.ID {
+				if e.Version != entry.Version {
+					return ErrVersionConflict
+				}
+				entry.Version++
+				(*entries)[i] = entry
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+}
+
+func (r *JSONEntryRepo) DeleteEntry(id string, version int) error {
+	return r.cache.update(func(entries *[]models.Entry) error {
+		for i, e := range *entries {
+			if e.ID == id {
+				if e.Version != version {
+					return ErrVersionConflict
+				}
+				*entries = append((*entries)[:i], (*entries)[i+1:]...)
+				return nil
+			}
+		}
+		return ErrNotFound
+	})
+}
+
+// JSONGoalRepo reads and writes goals on the user records in users.json.
+type JSONGoalRepo struct {
+	users *JSONUserRepo
+}
+
+func (r *JSONGoalRepo) GetGoals(userID string) (models.NutritionGoals, error) {
+	user, err := r.users.GetUser(userID)
+	if err != nil {
+		return models.NutritionGoals{}, err
+	}
+
+	return user.NutritionGoals, nil
+}
+
+func (r *JSONGoalRepo) UpdateGoals(userID string, goals models.NutritionGoals) error {
+	return r.users.update(userID, func(u *models.User) {
+		u.NutritionGoals = goals
+	})
+}
+
+func buildTokenIndex(revoked []models.RevokedToken) map[string]bool {
+	idx := make(map[string]bool, len(revoked))
+	for _, t := range revoked {
+		idx[t.ID] = true
+	}
+	return idx
+}
+
+type JSONTokenRepo struct {
+	cache *cachedFile[models.RevokedToken, map[string]bool]
+}
+
+func (r *JSONTokenRepo) RevokeToken(token models.RevokedToken) error {
+	return r.cache.update(func(revoked *[]models.RevokedToken) error {
+		// Drop entries for tokens that have expired on their own
+		now := time.Now()
+		var active []models.RevokedToken
+		for _, t := range *revoked {
+			if t.ID == token.ID {
+				return ErrAlreadyRevoked
+			}
+			if t.ExpiresAt.After(now) {
+				active = append(active, t)
+			}
+		}
+
+		*revoked = append(active, token)
+		return nil
+	})
+}
+
+func (r *JSONTokenRepo) IsTokenRevoked(id string) (bool, error) {
+	_, idx, err := r.cache.view()
+	if err != nil {
+		return false, err
+	}
+	return idx[id], nil
+}
+
+// buildFavoriteIndex maps each user to the indexes of their favorites.
+func buildFavoriteIndex(favorites []models.Favorite) map[string][]int {
+	idx := make(map[string][]int)
+	for i, f := range favorites {
+		idx[f.UserID] = append(idx[f.UserID], i)
+	}
+	return idx
+}
+
+type JSONFavoriteRepo struct {
+	cache *cachedFile[models.Favorite, map[string][]int]
+}
+
+func (r *JSONFavoriteRepo) Favorites(userID string) ([]models.Favorite, error) {
+	favorites, idx, err := r.cache.view()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []models.Favorite
+	for _, i := range idx[userID] {
+		result = append(result, favorites[i])
+	}
+	slices.SortStableFunc(result, func(a, b models.Favorite) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return result, nil
+}
+
+func (r *JSONFavoriteRepo) AddFavorite(fav models.Favorite) error {
+	return r.cache.update(func(favorites *[]models.Favorite) error {
+		if !slices.ContainsFunc(*favorites, func(f models.Favorite) bool {
+			return f.UserID == fav.UserID && f.FoodID == fav.FoodID
+		}) {
+			*favorites = append(*favorites, fav)
+		}
+		return nil
+	})
+}
+
+func (r *JSONFavoriteRepo) RemoveFavorite(userID, foodID string) error {
+	return r.cache.update(func(favorites *[]models.Favorite) error {
+		*favorites = slices.DeleteFunc(*favorites, func(f models.Favorite) bool {
+			return f.UserID == userID && f.FoodID == foodID
+		})
+		return nil
+	})
+}
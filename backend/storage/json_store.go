@@ -3,8 +3,12 @@ package storage
 import (
 	"encoding/json"
 	"fmt"
+	"log"
 	"os"
+	"path/filepath"
+	"reflect"
 	"sync"
+	"time"
 )
 
 type JSONStore struct {
@@ -22,9 +26,33 @@ func (s *JSONStore) LoadFromFile(filename string, v interface{}) error {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	filepath := fmt.Sprintf("%s/%s", s.dataPath, filename)
+	return s.load(filename, v)
+}
+
+func (s *JSONStore) load(filename string, v interface{}) error {
+	path := fmt.Sprintf("%s/%s", s.dataPath, filename)
+
+	err := decodeFile(path, v)
+	if _, ok := err.(*os.PathError); ok || err == nil {
+		return err
+	}
+
+	// The primary file exists but doesn't parse; try the previous version
+	log.Printf("Warning: %s is corrupt (%v), falling back to %s.bak", path, err, path)
+
+	resetValue(v)
+	if bakErr := decodeFile(path+".bak", v); bakErr != nil {
+		resetValue(v)
+		return fmt.Errorf("%s: %w (backup unusable: %v)", filename, err, bakErr)
+	}
+
+	return nil
+}
 
-	data, err := os.ReadFile(filepath)
+// decodeFile unmarshals the file at path into v. A missing or empty file
+// leaves v untouched and is not an error.
+func decodeFile(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// Return empty array if file doesn't exist
@@ -40,18 +68,152 @@ func (s *JSONStore) LoadFromFile(filename string, v interface{}) error {
 	return json.Unmarshal(data, v)
 }
 
+// resetValue zeroes whatever v points to, discarding a partial decode.
+func resetValue(v interface{}) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Pointer && !rv.IsNil() {
+		rv.Elem().Set(reflect.Zero(rv.Elem().Type()))
+	}
+}
+
+// SaveToFile replaces the file atomically: the new contents are written to a
+// temp file, synced and renamed over the original, so a crash leaves either
+// the old or the new version on disk. The previous version is kept as a
+// rolling .bak for LoadFromFile to fall back to.
 func (s *JSONStore) SaveToFile(filename string, v interface{}) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	filepath := fmt.Sprintf("%s/%s", s.dataPath, filename)
+	return s.save(filename, v)
+}
+
+// Update loads filename into v, calls fn to modify v and saves the result,
+// holding the write lock for the whole cycle so concurrent updates can't
+// lose each other's changes. If fn returns an error nothing is written.
+// fn must not call back into the store.
+func (s *JSONStore) Update(filename string, v interface{}, fn func() error) error {
+	return s.UpdateFiles(map[string]interface{}{filename: v}, fn)
+}
+
+// UpdateFiles is Update for operations spanning several files, such as
+// moving entries between foods. Each file is loaded into its value before
+// fn runs and all of them are saved afterwards. Saves happen one file at a
+// time, so a crash between them can leave only some files updated.
+func (s *JSONStore) UpdateFiles(files map[string]interface{}, fn func() error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for filename, v := range files {
+		if err := s.load(filename, v); err != nil {
+			return err
+		}
+	}
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	for filename, v := range files {
+		if err := s.save(filename, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *JSONStore) save(filename string, v interface{}) error {
+	path := fmt.Sprintf("%s/%s", s.dataPath, filename)
 
 	data, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(filepath, data, 0644)
+	tmp, err := os.CreateTemp(s.dataPath, filename+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath) // No-op once renamed
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpPath, 0644); err != nil {
+		return err
+	}
+
+	if err := backupFile(path); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	return syncDir(s.dataPath)
+}
+
+// backupFile points path.bak at the current contents of path without ever
+// leaving path itself missing.
+func backupFile(path string) error {
+	bak := path + ".bak"
+
+	if err := os.Remove(bak); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	err := os.Link(path, bak)
+	if err == nil || os.IsNotExist(err) {
+		return nil
+	}
+
+	// Hard links aren't supported everywhere; fall back to a copy
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(bak, data, 0644)
+}
+
+// syncDir flushes directory entries so a completed rename survives a crash.
+func syncDir(dir string) error {
+	d, err := os.Open(filepath.Clean(dir))
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// fileVersion identifies one on-disk version of a file so caches can tell
+// when it has been rewritten, by us or by hand.
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// version returns the current fileVersion of filename, or the zero value
+// if it doesn't exist.
+func (s *JSONStore) version(filename string) (fileVersion, error) {
+	info, err := os.Stat(fmt.Sprintf("%s/%s", s.dataPath, filename))
+	if os.IsNotExist(err) {
+		return fileVersion{}, nil
+	}
+	if err != nil {
+		return fileVersion{}, err
+	}
+	return fileVersion{modTime: info.ModTime(), size: info.Size()}, nil
 }
 
 func (s *JSONStore) EnsureDataDir() error {
@@ -0,0 +1,272 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+type migration struct {
+	version     int
+	description string
+	sql         string
+}
+
+// sqliteMigrations are applied in order by Migrate. Never edit a migration
+// that has shipped; append a new one instead.
+var sqliteMigrations = []migration{
+	{
+		version:     1,
+		description: "create users, foods, entries and revoked_tokens",
+		sql: `
+CREATE TABLE users (
+	id                 TEXT PRIMARY KEY,
+	email              TEXT NOT NULL UNIQUE,
+	name               TEXT NOT NULL,
+	password           TEXT NOT NULL,
+	daily_calorie_goal REAL NOT NULL,
+	daily_protein_goal REAL NOT NULL,
+	daily_carbs_goal   REAL NOT NULL,
+	daily_fats_goal    REAL NOT NULL,
+	created_at         TEXT NOT NULL
+);
+
+CREATE TABLE foods (
+	id           TEXT PRIMARY KEY,
+	user_id      TEXT NOT NULL DEFAULT '',
+	name         TEXT NOT NULL,
+	calories     REAL NOT NULL,
+	protein      REAL NOT NULL,
+	carbs        REAL NOT NULL,
+	fats         REAL NOT NULL,
+	serving_size REAL NOT NULL,
+	serving_unit TEXT NOT NULL,
+	category     TEXT NOT NULL,
+	created_at   TEXT NOT NULL
+);
+
+CREATE INDEX idx_foods_user_id ON foods (user_id);
+
+CREATE TABLE entries (
+	id              TEXT PRIMARY KEY,
+	user_id         TEXT NOT NULL,
+	food_id         TEXT NOT NULL,
+	food_name       TEXT NOT NULL,
+	quantity        REAL NOT NULL,
+	meal_type       TEXT NOT NULL,
+	eaten_at        INTEGER NOT NULL, -- Unix nanoseconds
+	eaten_at_offset INTEGER NOT NULL, -- Seconds east of UTC the entry was logged in
+	calories        REAL NOT NULL,
+	protein         REAL NOT NULL,
+	carbs           REAL NOT NULL,
+	fats            REAL NOT NULL,
+	created_at      TEXT NOT NULL
+);
+
+CREATE INDEX idx_entries_user_id_eaten_at ON entries (user_id, eaten_at);
+CREATE INDEX idx_entries_food_id ON entries (food_id);
+
+CREATE TABLE revoked_tokens (
+	id         TEXT PRIMARY KEY,
+	expires_at INTEGER NOT NULL -- Unix seconds
+);
+
+CREATE INDEX idx_revoked_tokens_expires_at ON revoked_tokens (expires_at);
+`,
+	},
+	{
+		version:     2,
+		description: "add version to foods and entries",
+		sql: `
+ALTER TABLE foods ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE entries ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		version:     3,
+		description: "add food_revisions and entries.food_version",
+		sql: `
+CREATE TABLE food_revisions (
+	id           TEXT NOT NULL, -- The food's ID
+	user_id      TEXT NOT NULL,
+	name         TEXT NOT NULL,
+	calories     REAL NOT NULL,
+	protein      REAL NOT NULL,
+	carbs        REAL NOT NULL,
+	fats         REAL NOT NULL,
+	serving_size REAL NOT NULL,
+	serving_unit TEXT NOT NULL,
+	category     TEXT NOT NULL,
+	version      INTEGER NOT NULL,
+	created_at   TEXT NOT NULL,
+	replaced_at  TEXT NOT NULL,
+	PRIMARY KEY (id, version)
+);
+
+ALTER TABLE entries ADD COLUMN food_version INTEGER NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		version:     4,
+		description: "add archived_at to foods",
+		sql: `
+ALTER TABLE foods ADD COLUMN archived_at TEXT NOT NULL DEFAULT ''; -- Empty unless archived
+ALTER TABLE food_revisions ADD COLUMN archived_at TEXT NOT NULL DEFAULT '';
+`,
+	},
+	{
+		version:     5,
+		description: "add recipe ingredients and yield to foods",
+		sql: `
+ALTER TABLE foods ADD COLUMN ingredients TEXT NOT NULL DEFAULT '[]'; -- JSON array of models.Ingredient
+ALTER TABLE foods ADD COLUMN yield_servings REAL NOT NULL DEFAULT 0;
+ALTER TABLE foods ADD COLUMN yield_weight REAL NOT NULL DEFAULT 0;
+ALTER TABLE food_revisions ADD COLUMN ingredients TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE food_revisions ADD COLUMN yield_servings REAL NOT NULL DEFAULT 0;
+ALTER TABLE food_revisions ADD COLUMN yield_weight REAL NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		version:     6,
+		description: "add food density and portions, entry amount and unit",
+		sql: `
+ALTER TABLE foods ADD COLUMN density REAL NOT NULL DEFAULT 0;
+ALTER TABLE foods ADD COLUMN portions TEXT NOT NULL DEFAULT '[]'; -- JSON array of models.Portion
+ALTER TABLE food_revisions ADD COLUMN density REAL NOT NULL DEFAULT 0;
+ALTER TABLE food_revisions ADD COLUMN portions TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE entries ADD COLUMN amount REAL NOT NULL DEFAULT 0;
+ALTER TABLE entries ADD COLUMN unit TEXT NOT NULL DEFAULT '';
+`,
+	},
+	{
+		version:     7,
+		description: "add micronutrients to foods and entries",
+		sql: `
+ALTER TABLE foods ADD COLUMN micronutrients TEXT NOT NULL DEFAULT '{}'; -- JSON models.Micronutrients
+ALTER TABLE food_revisions ADD COLUMN micronutrients TEXT NOT NULL DEFAULT '{}';
+ALTER TABLE entries ADD COLUMN micronutrients TEXT NOT NULL DEFAULT '{}';
+`,
+	},
+	{
+		version:     8,
+		description: "add user profile and fiber, sodium and sugar goals",
+		sql: `
+ALTER TABLE users ADD COLUMN age INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN sex TEXT NOT NULL DEFAULT '';
+ALTER TABLE users ADD COLUMN weight REAL NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN daily_fiber_goal REAL NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN daily_fiber_limit REAL NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN daily_sodium_goal REAL NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN daily_sodium_limit REAL NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN daily_sugar_goal REAL NOT NULL DEFAULT 0;
+ALTER TABLE users ADD COLUMN daily_sugar_limit REAL NOT NULL DEFAULT 0;
+`,
+	},
+	{
+		version:     9,
+		description: "count changes to food names for the search index",
+		sql: `
+CREATE TABLE food_changes (
+	count INTEGER NOT NULL
+);
+INSERT INTO food_changes (count) VALUES (0);
+
+CREATE TRIGGER foods_inserted AFTER INSERT ON foods
+BEGIN
+	UPDATE food_changes SET count = count + 1;
+END;
+CREATE TRIGGER foods_renamed AFTER UPDATE OF name ON foods
+BEGIN
+	UPDATE food_changes SET count = count + 1;
+END;
+CREATE TRIGGER foods_deleted AFTER DELETE ON foods
+BEGIN
+	UPDATE food_changes SET count = count + 1;
+END;
+`,
+	},
+	{
+		version:     10,
+		description: "add food barcodes",
+		sql: `
+ALTER TABLE foods ADD COLUMN barcode TEXT NOT NULL DEFAULT '';
+ALTER TABLE food_revisions ADD COLUMN barcode TEXT NOT NULL DEFAULT '';
+CREATE INDEX idx_foods_barcode ON foods (barcode) WHERE barcode != '';
+`,
+	},
+	{
+		version:     11,
+		description: "create favorites",
+		sql: `
+CREATE TABLE favorites (
+	user_id    TEXT NOT NULL,
+	food_id    TEXT NOT NULL,
+	created_at INTEGER NOT NULL, -- Unix nanoseconds
+	PRIMARY KEY (user_id, food_id)
+);
+`,
+	},
+	{
+		version:     12,
+		description: "add food tags, allergens and diets, and user allergens",
+		sql: `
+ALTER TABLE foods ADD COLUMN tags TEXT NOT NULL DEFAULT '[]'; -- JSON arrays of strings
+ALTER TABLE foods ADD COLUMN allergens TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE foods ADD COLUMN diets TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE food_revisions ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE food_revisions ADD COLUMN allergens TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE food_revisions ADD COLUMN diets TEXT NOT NULL DEFAULT '[]';
+ALTER TABLE users ADD COLUMN allergens TEXT NOT NULL DEFAULT '[]';
+`,
+	},
+}
+
+// Migrate brings the database schema up to date, applying each pending
+// migration in its own transaction and recording it in schema_migrations.
+func Migrate(db *sql.DB) error {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+	version     INTEGER PRIMARY KEY,
+	description TEXT NOT NULL,
+	applied_at  TEXT NOT NULL
+)`); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	var current int
+	if err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current); err != nil {
+		return fmt.Errorf("read schema version: %w", err)
+	}
+
+	for _, m := range sqliteMigrations {
+		if m.version <= current {
+			continue
+		}
+
+		if err := applyMigration(db, m); err != nil {
+			return fmt.Errorf("migration %d (%s): %w", m.version, m.description, err)
+		}
+	}
+
+	return nil
+}
+
+func applyMigration(db *sql.DB, m migration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(m.sql); err != nil {
+		return err
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, ?, ?)`,
+		m.version, m.description, time.Now().UTC().Format(time.RFC3339),
+	); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,109 @@
+package storage
+
+import (
+	"errors"
+	"time"
+
+	"myjunkpal/models"
+	"myjunkpal/search"
+)
+
+var (
+	ErrNotFound        = errors.New("not found")
+	ErrVersionConflict = errors.New("version conflict")
+	ErrInUse           = errors.New("in use")
+	ErrAlreadyRevoked  = errors.New("already revoked")
+)
+
+type UserRepo interface {
+	GetUser(id string) (*models.User, error)
+	GetUserByEmail(email string) (*models.User, error)
+	CreateUser(user models.User) error
+	UpdateUser(user models.User) error
+}
+
+type FoodRepo interface {
+	GetFood(id string) (*models.Food, error)
+	// FoodsVisibleTo returns system foods plus the user's custom foods,
+	// leaving out archived ones.
+	FoodsVisibleTo(userID string) ([]models.Food, error)
+	// GetFoodRevision returns the food as it was at version, which may be
+	// the current version.
+	GetFoodRevision(id string, version int) (*models.Food, error)
+	// FoodHistory returns the food's replaced versions, oldest first.
+	FoodHistory(id string) ([]models.FoodRevision, error)
+	// FoodsWithBarcode returns the user's custom foods and the system foods
+	// with the barcode, custom foods first, leaving out archived ones.
+	FoodsWithBarcode(barcode, userID string) ([]models.Food, error)
+	// SearchIndex returns the index of every stored food's name, archived
+	// or not, built once per change to the foods.
+	SearchIndex() (*search.Index, error)
+	// RecipesUsing returns the recipes, archived or not, that have the food
+	// as an ingredient.
+	RecipesUsing(foodID string) ([]models.Food, error)
+	CreateFood(food models.Food) error
+	// UpdateFood saves food if the stored version still equals food.Version,
+	// storing it as food.Version+1 and keeping the replaced version in the
+	// food's history. Otherwise it returns ErrVersionConflict.
+	UpdateFood(food models.Food) error
+	// DeleteFood permanently deletes the food if its stored version equals
+	// version. It returns ErrInUse if any entry or recipe still references
+	// the food; archive it with UpdateFood instead.
+	DeleteFood(id string, version int) error
+	// ReplaceFood is DeleteFood for a food whose entries are moved onto
+	// another: in the same transaction it applies move to every entry
+	// referencing the food, saving each as its next version, and returns
+	// how many moved. It still returns ErrInUse if a recipe uses the food.
+	ReplaceFood(id string, version int, move func(entry *models.Entry)) (int, error)
+}
+
+type EntryRepo interface {
+	GetEntry(id string) (*models.Entry, error)
+	EntriesForUser(userID string) ([]models.Entry, error)
+	// EntriesForUserInRange returns entries eaten in [start, end). A zero
+	// start or end leaves that side unbounded.
+	EntriesForUserInRange(userID string, start, end time.Time) ([]models.Entry, error)
+	// EntriesForFood returns every user's entries that reference the food.
+	EntriesForFood(foodID string) ([]models.Entry, error)
+	CreateEntry(entry models.Entry) error
+	// UpdateEntry saves entry if the stored version still equals
+	// entry.Version, storing it as entry.Version+1. Otherwise it returns
+	// ErrVersionConflict.
+	UpdateEntry(entry models.Entry) error
+	// DeleteEntry deletes the entry if its stored version equals version.
+	DeleteEntry(id string, version int) error
+}
+
+type GoalRepo interface {
+	GetGoals(userID string) (models.NutritionGoals, error)
+	UpdateGoals(userID string, goals models.NutritionGoals) error
+}
+
+type TokenRepo interface {
+	// RevokeToken records the token as revoked, or returns
+	// ErrAlreadyRevoked if it already was.
+	RevokeToken(token models.RevokedToken) error
+	IsTokenRevoked(id string) (bool, error)
+}
+
+type FavoriteRepo interface {
+	// Favorites returns the user's favorite foods, most recently added
+	// first.
+	Favorites(userID string) ([]models.Favorite, error)
+	// AddFavorite stores the favorite; adding one that exists leaves it
+	// as it was.
+	AddFavorite(fav models.Favorite) error
+	// RemoveFavorite removes the favorite if there is one.
+	RemoveFavorite(userID, foodID string) error
+}
+
+// Repositories bundles one implementation of each repository so a backend
+// can be chosen in one place at startup.
+type Repositories struct {
+	Users     UserRepo
+	Foods     FoodRepo
+	Entries   EntryRepo
+	Goals     GoalRepo
+	Tokens    TokenRepo
+	Favorites FavoriteRepo
+}
@@ -0,0 +1,708 @@
+package storage
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"myjunkpal/models"
+	"myjunkpal/search"
+
+	_ "modernc.org/sqlite"
+)
+
+// OpenSQLite opens (creating if needed) the SQLite database at path and
+// applies any pending schema migrations.
+func OpenSQLite(path string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// NewSQLiteRepositories returns repositories backed by a migrated SQLite
+// database.
+func NewSQLiteRepositories(db *sql.DB) *Repositories {
+	return &Repositories{
+		Users:   &SQLiteUserRepo{db: db},
+		Foods:   &SQLiteFoodRepo{db: db},
+		Entries: &SQLiteEntryRepo{db: db},
+		Goals:   &SQLiteGoalRepo{db: db},
+		Tokens:  &SQLiteTokenRepo{db: db},
+
+		Favorites: &SQLiteFavoriteRepo{db: db},
+	}
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows.
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// queryRower is satisfied by both *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
+
+func parseTime(s string) (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, s)
+}
+
+// formatOptionalTime and parseOptionalTime store a zero time as "".
+func formatOptionalTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return formatTime(t)
+}
+
+func parseOptionalTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return parseTime(s)
+}
+
+// notFound maps sql.ErrNoRows to ErrNotFound.
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// requireVersion is requireRow for statements guarded by
+// "WHERE id = ? AND version = ?": when nothing matched it looks the row up
+// in table to tell ErrNotFound from ErrVersionConflict.
+func requireVersion(db queryRower, table, id string, res sql.Result, err error) error {
+	err = requireRow(res, err)
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM `+table+` WHERE id = ?`, id).Scan(&n); err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrVersionConflict
+	}
+	return ErrNotFound
+}
+
+// requireRow returns ErrNotFound when an UPDATE or DELETE matched nothing.
+func requireRow(res sql.Result, err error) error {
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+type SQLiteUserRepo struct {
+	db *sql.DB
+}
+
+const userColumns = `id, email, name, password, created_at, age, sex, weight, allergens, ` + goalColumns
+
+const goalColumns = `daily_calorie_goal, daily_protein_goal, daily_carbs_goal, daily_fats_goal,
+	daily_fiber_goal, daily_fiber_limit, daily_sodium_goal, daily_sodium_limit, daily_sugar_goal,
+	daily_sugar_limit`
+
+// goalFields returns pointers to the goals in goalColumns order.
+func goalFields(g *models.NutritionGoals) []any {
+	return []any{&g.DailyCalorieGoal, &g.DailyProteinGoal, &g.DailyCarbsGoal, &g.DailyFatsGoal,
+		&g.DailyFiberGoal, &g.DailyFiberLimit, &g.DailySodiumGoal, &g.DailySodiumLimit,
+		&g.DailySugarGoal, &g.DailySugarLimit}
+}
+
+func goalArgs(g models.NutritionGoals) []any {
+	return []any{g.DailyCalorieGoal, g.DailyProteinGoal, g.DailyCarbsGoal, g.DailyFatsGoal,
+		g.DailyFiberGoal, g.DailyFiberLimit, g.DailySodiumGoal, g.DailySodiumLimit,
+		g.DailySugarGoal, g.DailySugarLimit}
+}
+
+func scanUser(row rowScanner) (*models.User, error) {
+	var u models.User
+	var createdAt, allergens string
+
+	dest := []any{&u.ID, &u.Email, &u.Name, &u.Password, &createdAt, &u.Age, &u.Sex, &u.Weight, &allergens}
+	if err := row.Scan(append(dest, goalFields(&u.NutritionGoals)...)...); err != nil {
+		return nil, notFound(err)
+	}
+
+	var err error
+	if u.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(allergens), &u.Allergens); err != nil {
+		return nil, fmt.Errorf("user %s allergens: %w", u.ID, err)
+	}
+	return &u, nil
+}
+
+func (r *SQLiteUserRepo) GetUser(id string) (*models.User, error) {
+	return scanUser(r.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE id = ?`, id))
+}
+
+func (r *SQLiteUserRepo) GetUserByEmail(email string) (*models.User, error) {
+	return scanUser(r.db.QueryRow(`SELECT `+userColumns+` FROM users WHERE email = ?`, email))
+}
+
+func userArgs(user models.User) []any {
+	args := []any{user.ID, user.Email, user.Name, user.Password, formatTime(user.CreatedAt),
+		user.Age, user.Sex, user.Weight, jsonColumn(user.Allergens)}
+	return append(args, goalArgs(user.NutritionGoals)...)
+}
+
+func (r *SQLiteUserRepo) CreateUser(user models.User) error {
+	args := userArgs(user)
+	_, err := r.db.Exec(`INSERT INTO users (`+userColumns+`) VALUES (`+placeholders(len(args))+`)`, args...)
+	return err
+}
+
+func (r *SQLiteUserRepo) UpdateUser(user models.User) error {
+	args := userArgs(user)
+	return requireRow(r.db.Exec(`UPDATE users SET email = ?, name = ?, password = ?,
+	created_at = ?, age = ?, sex = ?, weight = ?, allergens = ?, daily_calorie_goal = ?, daily_protein_goal = ?,
+	daily_carbs_goal = ?, daily_fats_goal = ?, daily_fiber_goal = ?, daily_fiber_limit = ?,
+	daily_sodium_goal = ?, daily_sodium_limit = ?, daily_sugar_goal = ?, daily_sugar_limit = ?
+	WHERE id = ?`, append(args[1:], user.ID)...))
+}
+
+type SQLiteFoodRepo struct {
+	db *sql.DB
+
+	mu      sync.Mutex
+	index   *search.Index
+	changes int64 // food_changes.count the index was built at
+}
+
+const foodColumns = `id, user_id, name, calories, protein, carbs, fats, serving_size,
+	serving_unit, category, version, created_at, archived_at, ingredients, yield_servings,
+	yield_weight, density, portions, micronutrients, barcode, tags, allergens, diets`
+
+// scanFood scans a row selected with foodColumns, followed by any extra
+// columns into extra.
+func scanFood(row rowScanner, extra ...any) (*models.Food, error) {
+	var f models.Food
+	var createdAt, archivedAt, ingredients, portions, micros, tags, allergens, diets string
+	var yield models.RecipeYield
+
+	dest := []any{&f.ID, &f.UserID, &f.Name, &f.Calories, &f.Protein, &f.Carbs, &f.Fats,
+		&f.ServingSize, &f.ServingUnit, &f.Category, &f.Version, &createdAt, &archivedAt,
+		&ingredients, &yield.Servings, &yield.Weight, &f.Density, &portions, &micros, &f.Barcode,
+		&tags, &allergens, &diets}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, notFound(err)
+	}
+
+	var err error
+	if f.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	if f.ArchivedAt, err = parseOptionalTime(archivedAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(ingredients), &f.Ingredients); err != nil {
+		return nil, fmt.Errorf("food %s ingredients: %w", f.ID, err)
+	}
+	if err := json.Unmarshal([]byte(portions), &f.Portions); err != nil {
+		return nil, fmt.Errorf("food %s portions: %w", f.ID, err)
+	}
+	if err := json.Unmarshal([]byte(micros), &f.Micronutrients); err != nil {
+		return nil, fmt.Errorf("food %s micronutrients: %w", f.ID, err)
+	}
+	if err := json.Unmarshal([]byte(tags), &f.Tags); err != nil {
+		return nil, fmt.Errorf("food %s tags: %w", f.ID, err)
+	}
+	if err := json.Unmarshal([]byte(allergens), &f.Allergens); err != nil {
+		return nil, fmt.Errorf("food %s allergens: %w", f.ID, err)
+	}
+	if err := json.Unmarshal([]byte(diets), &f.Diets); err != nil {
+		return nil, fmt.Errorf("food %s diets: %w", f.ID, err)
+	}
+	if yield != (models.RecipeYield{}) {
+		f.Yield = &yield
+	}
+	return &f, nil
+}
+
+func micronutrientsColumn(m models.Micronutrients) string {
+	data, _ := json.Marshal(m)
+	return string(data)
+}
+
+// jsonColumn encodes a slice for a JSON column, storing nil as [].
+func jsonColumn[T any](items []T) string {
+	if items == nil {
+		return "[]"
+	}
+	data, _ := json.Marshal(items)
+	return string(data)
+}
+
+func foodArgs(food models.Food) []any {
+	var yield models.RecipeYield
+	if food.Yield != nil {
+		yield = *food.Yield
+	}
+
+	return []any{food.ID, food.UserID, food.Name, food.Calories, food.Protein, food.Carbs,
+		food.Fats, food.ServingSize, food.ServingUnit, food.Category, food.Version,
+		formatTime(food.CreatedAt), formatOptionalTime(food.ArchivedAt), jsonColumn(food.Ingredients),
+		yield.Servings, yield.Weight, food.Density, jsonColumn(food.Portions),
+		micronutrientsColumn(food.Micronutrients), food.Barcode, jsonColumn(food.Tags),
+		jsonColumn(food.Allergens), jsonColumn(food.Diets)}
+}
+
+// placeholders returns n comma-separated "?" for a VALUES list.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func (r *SQLiteFoodRepo) queryFoods(query string, args ...any) ([]models.Food, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var foods []models.Food
+	for rows.Next() {
+		f, err := scanFood(rows)
+		if err != nil {
+			return nil, err
+		}
+		foods = append(foods, *f)
+	}
+	return foods, rows.Err()
+}
+
+func (r *SQLiteFoodRepo) GetFood(id string) (*models.Food, error) {
+	return scanFood(r.db.QueryRow(`SELECT `+foodColumns+` FROM foods WHERE id = ?`, id))
+}
+
+func (r *SQLiteFoodRepo) GetFoodRevision(id string, version int) (*models.Food, error) {
+	food, err := scanFood(r.db.QueryRow(`SELECT `+foodColumns+` FROM foods WHERE id = ? AND version = ?
+	UNION ALL SELECT `+foodColumns+` FROM food_revisions WHERE id = ? AND version = ?
+	LIMIT 1`, id, version, id, version))
+	return food, err
+}
+
+func (r *SQLiteFoodRepo) FoodHistory(id string) ([]models.FoodRevision, error) {
+	rows, err := r.db.Query(`SELECT `+foodColumns+`, replaced_at FROM food_revisions
+	WHERE id = ? ORDER BY version`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var history []models.FoodRevision
+	for rows.Next() {
+		var replacedAt string
+		f, err := scanFood(rows, &replacedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		rev := models.FoodRevision{Food: *f}
+		if rev.ReplacedAt, err = parseTime(replacedAt); err != nil {
+			return nil, err
+		}
+		history = append(history, rev)
+	}
+	return history, rows.Err()
+}
+
+func (r *SQLiteFoodRepo) RecipesUsing(foodID string) ([]models.Food, error) {
+	return r.queryFoods(`SELECT `+foodColumns+` FROM foods WHERE EXISTS (
+	SELECT 1 FROM json_each(foods.ingredients) WHERE json_extract(value, '$.food_id') = ?
+) ORDER BY rowid`, foodID)
+}
+
+func (r *SQLiteFoodRepo) FoodsWithBarcode(barcode, userID string) ([]models.Food, error) {
+	return r.queryFoods(`SELECT `+foodColumns+` FROM foods
+	WHERE barcode = ? AND (user_id = '' OR user_id = ?) AND archived_at = ''
+	ORDER BY user_id = '', rowid`, barcode, userID)
+}
+
+// SearchIndex rebuilds the index when food_changes shows foods were
+// added, renamed or deleted since it was built, by this process or
+// another one such as import-foods.
+func (r *SQLiteFoodRepo) SearchIndex() (*search.Index, error) {
+	// Read the count before the names so the recorded count is never newer
+	// than the index; at worst a concurrent change triggers one extra build
+	var changes int64
+	if err := r.db.QueryRow(`SELECT count FROM food_changes`).Scan(&changes); err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.index != nil && r.changes == changes {
+		return r.index, nil
+	}
+
+	rows, err := r.db.Query(`SELECT id, name FROM foods`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var foods []models.Food
+	for rows.Next() {
+		var f models.Food
+		if err := rows.Scan(&f.ID, &f.Name); err != nil {
+			return nil, err
+		}
+		foods = append(foods, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	r.index, r.changes = search.NewIndex(foods), changes
+	return r.index, nil
+}
+
+func (r *SQLiteFoodRepo) FoodsVisibleTo(userID string) ([]models.Food, error) {
+	return r.queryFoods(`SELECT `+foodColumns+` FROM foods
+	WHERE (user_id = '' OR user_id = ?) AND archived_at = '' ORDER BY rowid`, userID)
+}
+
+func (r *SQLiteFoodRepo) CreateFood(food models.Food) error {
+	args := foodArgs(food)
+	_, err := r.db.Exec(`INSERT INTO foods (`+foodColumns+`) VALUES (`+placeholders(len(args))+`)`, args...)
+	return err
+}
+
+func (r *SQLiteFoodRepo) UpdateFood(food models.Food) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Keep the version being replaced; matching nothing here means the
+	// UPDATE below will match nothing either
+	if _, err := tx.Exec(`INSERT INTO food_revisions (`+foodColumns+`, replaced_at)
+	SELECT `+foodColumns+`, ? FROM foods WHERE id = ? AND version = ?`,
+		formatTime(time.Now()), food.ID, food.Version); err != nil {
+		return err
+	}
+
+	res, err := tx.Exec(`UPDATE foods SET user_id = ?, name = ?, calories = ?,
+	protein = ?, carbs = ?, fats = ?, serving_size = ?, serving_unit = ?, category = ?,
+	version = ? + 1, created_at = ?, archived_at = ?, ingredients = ?, yield_servings = ?,
+	yield_weight = ?, density = ?, portions = ?, micronutrients = ?, barcode = ?, tags = ?,
+	allergens = ?, diets = ? WHERE id = ? AND version = ?`,
+		// Move the ID to the end and add the version for the WHERE clause
+		append(foodArgs(food)[1:], food.ID, food.Version)...)
+	if err := requireVersion(tx, "foods", food.ID, res, err); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *SQLiteFoodRepo) DeleteFood(id string, version int) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var inUse bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM entries WHERE food_id = ?)
+	OR EXISTS (SELECT 1 FROM foods, json_each(foods.ingredients)
+		WHERE json_extract(json_each.value, '$.food_id') = ?)`, id, id).Scan(&inUse); err != nil {
+		return err
+	}
+	if inUse {
+		return ErrInUse
+	}
+
+	res, err := tx.Exec(`DELETE FROM foods WHERE id = ? AND version = ?`, id, version)
+	if err := requireVersion(tx, "foods", id, res, err); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (r *SQLiteFoodRepo) ReplaceFood(id string, version int, move func(entry *models.Entry)) (int, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var inUse bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM foods, json_each(foods.ingredients)
+		WHERE json_extract(json_each.value, '$.food_id') = ?)`, id).Scan(&inUse); err != nil {
+		return 0, err
+	}
+	if inUse {
+		return 0, ErrInUse
+	}
+
+	res, err := tx.Exec(`DELETE FROM foods WHERE id = ? AND version = ?`, id, version)
+	if err := requireVersion(tx, "foods", id, res, err); err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Query(`SELECT `+entryColumns+` FROM entries WHERE food_id = ?`, id)
+	if err != nil {
+		return 0, err
+	}
+	var entries []models.Entry
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		entries = append(entries, *e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, e := range entries {
+		move(&e)
+		args := entryArgs(e)
+		if _, err := tx.Exec(updateEntry, append(args[1:], args[0], e.Version)...); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(entries), tx.Commit()
+}
+
+type SQLiteEntryRepo struct {
+	db *sql.DB
+}
+
+const entryColumns = `id, user_id, food_id, food_name, quantity, meal_type, eaten_at,
+	eaten_at_offset, calories, protein, carbs, fats, version, food_version, created_at, amount,
+	unit, micronutrients`
+
+func scanEntry(row rowScanner) (*models.Entry, error) {
+	var e models.Entry
+	var eatenAt, offset int64
+	var createdAt, micros string
+
+	if err := row.Scan(&e.ID, &e.UserID, &e.FoodID, &e.FoodName, &e.Quantity, &e.MealType,
+		&eatenAt, &offset, &e.Calories, &e.Protein, &e.Carbs, &e.Fats, &e.Version, &e.FoodVersion,
+		&createdAt, &e.Amount, &e.Unit, &micros); err != nil {
+		return nil, notFound(err)
+	}
+
+	// Restore the offset the entry was logged in; calendar-day grouping
+	// in the nutrition summaries depends on it
+	e.EatenAt = time.Unix(0, eatenAt).In(zoneForOffset(int(offset)))
+
+	var err error
+	if e.CreatedAt, err = parseTime(createdAt); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(micros), &e.Micronutrients); err != nil {
+		return nil, fmt.Errorf("entry %s micronutrients: %w", e.ID, err)
+	}
+	return &e, nil
+}
+
+func zoneForOffset(offset int) *time.Location {
+	if offset == 0 {
+		return time.UTC
+	}
+	return time.FixedZone("", offset)
+}
+
+func entryArgs(entry models.Entry) []any {
+	_, offset := entry.EatenAt.Zone()
+	return []any{entry.ID, entry.UserID, entry.FoodID, entry.FoodName, entry.Quantity,
+		entry.MealType, entry.EatenAt.UnixNano(), offset, entry.Calories, entry.Protein,
+		entry.Carbs, entry.Fats, entry.Version, entry.FoodVersion, formatTime(entry.CreatedAt),
+		entry.Amount, entry.Unit, micronutrientsColumn(entry.Micronutrients)}
+}
+
+func (r *SQLiteEntryRepo) queryEntries(query string, args ...any) ([]models.Entry, error) {
+	rows, err := r.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []models.Entry
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, *e)
+	}
+	return entries, rows.Err()
+}
+
+func (r *SQLiteEntryRepo) GetEntry(id string) (*models.Entry, error) {
+	return scanEntry(r.db.QueryRow(`SELECT `+entryColumns+` FROM entries WHERE id = ?`, id))
+}
+
+func (r *SQLiteEntryRepo) EntriesForUser(userID string) ([]models.Entry, error) {
+	return r.queryEntries(`SELECT `+entryColumns+` FROM entries WHERE user_id = ?
+	ORDER BY eaten_at`, userID)
+}
+
+func (r *SQLiteEntryRepo) EntriesForFood(foodID string) ([]models.Entry, error) {
+	return r.queryEntries(`SELECT `+entryColumns+` FROM entries WHERE food_id = ?
+	ORDER BY eaten_at`, foodID)
+}
+
+func (r *SQLiteEntryRepo) EntriesForUserInRange(userID string, start, end time.Time) ([]models.Entry, error) {
+	query := `SELECT ` + entryColumns + ` FROM entries WHERE user_id = ?`
+	args := []any{userID}
+
+	if !start.IsZero() {
+		query += ` AND eaten_at >= ?`
+		args = append(args, start.UnixNano())
+	}
+	if !end.IsZero() {
+		query += ` AND eaten_at < ?`
+		args = append(args, end.UnixNano())
+	}
+
+	return r.queryEntries(query+` ORDER BY eaten_at`, args...)
+}
+
+func (r *SQLiteEntryRepo) CreateEntry(entry models.Entry) error {
+	args := entryArgs(entry)
+	_, err := r.db.Exec(`INSERT INTO entries (`+entryColumns+`) VALUES (`+placeholders(len(args))+`)`, args...)
+	return err
+}
+
+// updateEntry saves an entry as the next version, taking entryArgs with the
+// ID moved to the end and the version being replaced after it.
+const updateEntry = `UPDATE entries SET user_id = ?, food_id = ?, food_name = ?,
+	quantity = ?, meal_type = ?, eaten_at = ?, eaten_at_offset = ?, calories = ?, protein = ?,
+	carbs = ?, fats = ?, version = ? + 1, food_version = ?, created_at = ?, amount = ?, unit = ?,
+	micronutrients = ? WHERE id = ? AND version = ?`
+
+func (r *SQLiteEntryRepo) UpdateEntry(entry models.Entry) error {
+	args := entryArgs(entry)
+	// Move the ID and version to the end for the WHERE clause
+	args = append(args[1:], args[0], entry.Version)
+
+	res, err := r.db.Exec(updateEntry, args...)
+	return requireVersion(r.db, "entries", entry.ID, res, err)
+}
+
+func (r *SQLiteEntryRepo) DeleteEntry(id string, version int) error {
+	res, err := r.db.Exec(`DELETE FROM entries WHERE id = ? AND version = ?`, id, version)
+	return requireVersion(r.db, "entries", id, res, err)
+}
+
+// SQLiteGoalRepo reads and writes the goal columns on the users table.
+type SQLiteGoalRepo struct {
+	db *sql.DB
+}
+
+func (r *SQLiteGoalRepo) GetGoals(userID string) (models.NutritionGoals, error) {
+	var g models.NutritionGoals
+	err := r.db.QueryRow(`SELECT `+goalColumns+` FROM users WHERE id = ?`, userID).Scan(goalFields(&g)...)
+	return g, notFound(err)
+}
+
+func (r *SQLiteGoalRepo) UpdateGoals(userID string, goals models.NutritionGoals) error {
+	return requireRow(r.db.Exec(`UPDATE users SET daily_calorie_goal = ?, daily_protein_goal = ?,
+	daily_carbs_goal = ?, daily_fats_goal = ?, daily_fiber_goal = ?, daily_fiber_limit = ?,
+	daily_sodium_goal = ?, daily_sodium_limit = ?, daily_sugar_goal = ?, daily_sugar_limit = ?
+	WHERE id = ?`, append(goalArgs(goals), userID)...))
+}
+
+type SQLiteTokenRepo struct {
+	db *sql.DB
+}
+
+func (r *SQLiteTokenRepo) RevokeToken(token models.RevokedToken) error {
+	// Drop entries for tokens that have expired on their own
+	if _, err := r.db.Exec(`DELETE FROM revoked_tokens WHERE expires_at <= ?`, time.Now().Unix()); err != nil {
+		return err
+	}
+
+	res, err := r.db.Exec(`INSERT INTO revoked_tokens (id, expires_at) VALUES (?, ?)
+	ON CONFLICT (id) DO NOTHING`, token.ID, token.ExpiresAt.Unix())
+	err = requireRow(res, err)
+	if errors.Is(err, ErrNotFound) {
+		return ErrAlreadyRevoked
+	}
+	return err
+}
+
+func (r *SQLiteTokenRepo) IsTokenRevoked(id string) (bool, error) {
+	var n int
+	err := r.db.QueryRow(`SELECT COUNT(*) FROM revoked_tokens WHERE id = ?`, id).Scan(&n)
+	return n > 0, err
+}
+
+type SQLiteFavoriteRepo struct {
+	db *sql.DB
+}
+
+func (r *SQLiteFavoriteRepo) Favorites(userID string) ([]models.Favorite, error) {
+	rows, err := r.db.Query(`SELECT user_id, food_id, created_at FROM favorites
+	WHERE user_id = ? ORDER BY created_at DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var favorites []models.Favorite
+	for rows.Next() {
+		var f models.Favorite
+		var createdAt int64
+		if err := rows.Scan(&f.UserID, &f.FoodID, &createdAt); err != nil {
+			return nil, err
+		}
+		f.CreatedAt = time.Unix(0, createdAt)
+		favorites = append(favorites, f)
+	}
+	return favorites, rows.Err()
+}
+
+func (r *SQLiteFavoriteRepo) AddFavorite(fav models.Favorite) error {
+	_, err := r.db.Exec(`INSERT INTO favorites (user_id, food_id, created_at) VALUES (?, ?, ?)
+	ON CONFLICT (user_id, food_id) DO NOTHING`, fav.UserID, fav.FoodID, fav.CreatedAt.UnixNano())
+	return err
+}
+
+func (r *SQLiteFavoriteRepo) RemoveFavorite(userID, foodID string) error {
+	_, err := r.db.Exec(`DELETE FROM favorites WHERE user_id = ? AND food_id = ?`, userID, foodID)
+	return err
+}
@@ -0,0 +1,175 @@
+// Package units converts amounts between units of mass and volume.
+package units
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type Dimension int
+
+const (
+	Mass   Dimension = iota + 1 // Base unit: gram
+	Volume                      // Base unit: millilitre
+)
+
+func (d Dimension) String() string {
+	switch d {
+	case Mass:
+		return "mass"
+	case Volume:
+		return "volume"
+	}
+	return "unknown"
+}
+
+// Unit is a unit of mass or volume. Factor is its size in the dimension's
+// base unit.
+type Unit struct {
+	Name      string
+	Dimension Dimension
+	Factor    float64
+}
+
+var ErrIncompatible = errors.New("incompatible units")
+
+// Volumes are US customary; a metric cup or spoon is within a few percent,
+// which is well inside the error of measuring food by the cup.
+var known = []struct {
+	unit    Unit
+	aliases []string
+}{
+	{Unit{"mg", Mass, 0.001}, []string{"milligram", "milligrams", "milligramme", "milligrammes"}},
+	{Unit{"g", Mass, 1}, []string{"gram", "grams", "gramme", "grammes"}},
+	{Unit{"kg", Mass, 1000}, []string{"kilogram", "kilograms", "kilogramme", "kilogrammes", "kilo", "kilos"}},
+	{Unit{"oz", Mass, 28.349523125}, []string{"ounce", "ounces"}},
+	{Unit{"lb", Mass, 453.59237}, []string{"lbs", "pound", "pounds"}},
+
+	{Unit{"ml", Volume, 1}, []string{"milliliter", "milliliters", "millilitre", "millilitres", "cc"}},
+	{Unit{"cl", Volume, 10}, []string{"centiliter", "centiliters", "centilitre", "centilitres"}},
+	{Unit{"dl", Volume, 100}, []string{"deciliter", "deciliters", "decilitre", "decilitres"}},
+	{Unit{"l", Volume, 1000}, []string{"liter", "liters", "litre", "litres"}},
+	{Unit{"tsp", Volume, 4.92892159375}, []string{"teaspoon", "teaspoons", "tsps"}},
+	{Unit{"tbsp", Volume, 14.78676478125}, []string{"tablespoon", "tablespoons", "tbsps", "tbs", "tbl"}},
+	{Unit{"fl oz", Volume, 29.5735295625}, []string{"floz", "fluid ounce", "fluid ounces", "fl ounce", "fl ounces"}},
+	{Unit{"cup", Volume, 236.5882365}, []string{"cups", "c"}},
+	{Unit{"pint", Volume, 473.176473}, []string{"pints", "pt"}},
+	{Unit{"quart", Volume, 946.352946}, []string{"quarts", "qt"}},
+	{Unit{"gallon", Volume, 3785.411784}, []string{"gallons", "gal"}},
+}
+
+var byName = func() map[string]Unit {
+	m := make(map[string]Unit)
+	for _, k := range known {
+		m[k.unit.Name] = k.unit
+		for _, alias := range k.aliases {
+			m[alias] = k.unit
+		}
+	}
+	return m
+}()
+
+// Lookup finds a unit by name or common alias, ignoring case, periods and
+// extra spaces ("Tbsp.", "fl. oz", "grams").
+func Lookup(name string) (Unit, bool) {
+	name = strings.ToLower(strings.ReplaceAll(name, ".", ""))
+	name = strings.Join(strings.Fields(name), " ")
+
+	u, ok := byName[name]
+	return u, ok
+}
+
+// Convert converts amount from one unit to another of the same dimension.
+func Convert(amount float64, from, to Unit) (float64, error) {
+	if from.Dimension != to.Dimension {
+		return 0, fmt.Errorf("%w: %s is %s, %s is %s", ErrIncompatible, from.Name, from.Dimension, to.Name, to.Dimension)
+	}
+	return amount * from.Factor / to.Factor, nil
+}
+
+var ErrUnknownUnit = errors.New("unknown unit")
+
+// Portion is a named amount of a particular food, such as "slice" = 28 g.
+type Portion struct {
+	Name   string
+	Amount float64
+	Unit   Unit
+}
+
+// Converter converts amounts of one food, using what's known about it on
+// top of the fixed units: its density, which links mass and volume, and
+// named portions. Portions take precedence over units of the same name,
+// so a food can say how much a cup of it weighs.
+type Converter struct {
+	Density  float64 // Grams per millilitre, 0 if unknown
+	Portions []Portion
+}
+
+// Convert converts amount between two units or portion names. Converting
+// a name to itself always works, even if it's neither.
+func (c Converter) Convert(amount float64, from, to string) (float64, error) {
+	if portionKey(from) == portionKey(to) {
+		return amount, nil
+	}
+
+	fromSize, fromDim, err := c.size(from)
+	if err != nil {
+		return 0, err
+	}
+	toSize, toDim, err := c.size(to)
+	if err != nil {
+		return 0, err
+	}
+
+	base := amount * fromSize
+	if fromDim != toDim {
+		if c.Density <= 0 {
+			return 0, fmt.Errorf("%w: %s is %s and %s is %s, and there's no density to convert between them",
+				ErrIncompatible, from, fromDim, to, toDim)
+		}
+		if fromDim == Volume {
+			base *= c.Density
+		} else {
+			base /= c.Density
+		}
+	}
+	return base / toSize, nil
+}
+
+// size returns how much one of the named unit or portion is in the base
+// unit of its dimension.
+func (c Converter) size(name string) (float64, Dimension, error) {
+	key := portionKey(name)
+	for _, p := range c.Portions {
+		if portionKey(p.Name) == key {
+			return p.Amount * p.Unit.Factor, p.Unit.Dimension, nil
+		}
+	}
+
+	if u, ok := Lookup(name); ok {
+		return u.Factor, u.Dimension, nil
+	}
+	return 0, 0, fmt.Errorf("%w %q", ErrUnknownUnit, name)
+}
+
+// portionKey normalises a portion name for comparison, so "Slices" finds
+// "slice".
+func portionKey(name string) string {
+	key := strings.Join(strings.Fields(strings.ToLower(name)), " ")
+	if len(key) > 3 && strings.HasSuffix(key, "s") && !strings.HasSuffix(key, "ss") {
+		key = key[:len(key)-1]
+	}
+	return key
+}
+
+// HasPortion reports whether the converter has a portion with this name.
+func (c Converter) HasPortion(name string) bool {
+	key := portionKey(name)
+	for _, p := range c.Portions {
+		if portionKey(p.Name) == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package units
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestLookup(t *testing.T) {
+	tests := []struct {
+		name   string
+		want   string
+		wantOK bool
+	}{
+		{"g", "g", true},
+		{"Grams", "g", true},
+		{"kilos", "kg", true},
+		{"Tbsp.", "tbsp", true},
+		{"fl. oz", "fl oz", true},
+		{"fluid  ounces", "fl oz", true},
+		{"C", "cup", true},
+		{"gr", "", false}, // Grain, not gram
+		{"handful", "", false},
+		{"", "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, ok := Lookup(tt.name)
+			if ok != tt.wantOK || u.Name != tt.want {
+				t.Errorf("Lookup(%q) = %q, %v, want %q, %v", tt.name, u.Name, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestConverterConvert(t *testing.T) {
+	flour := Converter{
+		Density: 0.53,
+		Portions: []Portion{
+			{Name: "cup", Amount: 125, Unit: mustLookup(t, "g")},
+			{Name: "slice", Amount: 28, Unit: mustLookup(t, "g")},
+		},
+	}
+	milk := Converter{Density: 1.03}
+	noDensity := Converter{}
+
+	tests := []struct {
+		name     string
+		c        Converter
+		amount   float64
+		from, to string
+		want     float64
+		wantErr  error
+	}{
+		{"mass", noDensity, 1, "kg", "g", 1000, nil},
+		{"pounds to ounces", noDensity, 1, "lb", "oz", 16, nil},
+		{"volume", noDensity, 3, "tsp", "tbsp", 1, nil},
+		{"cups to ml", noDensity, 1, "cup", "ml", 236.5882365, nil},
+		{"volume to mass by density", milk, 100, "ml", "g", 103, nil},
+		{"mass to volume by density", milk, 103, "g", "ml", 100, nil},
+		{"portion", flour, 2, "slices", "g", 56, nil},
+		{"portion overrides unit", flour, 1, "cup", "g", 125, nil},
+		{"grams to portion", flour, 250, "g", "Cups", 2, nil},
+		{"same name", noDensity, 3, "handful", "Handfuls", 3, nil},
+		{"no density", noDensity, 1, "cup", "g", 0, ErrIncompatible},
+		{"unknown unit", noDensity, 1, "handful", "g", 0, ErrUnknownUnit},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.c.Convert(tt.amount, tt.from, tt.to)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Convert(%g, %q, %q) error = %v, want %v", tt.amount, tt.from, tt.to, err, tt.wantErr)
+			}
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Convert(%g, %q, %q) = %g, want %g", tt.amount, tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertIncompatible(t *testing.T) {
+	_, err := Convert(1, mustLookup(t, "cup"), mustLookup(t, "g"))
+	if !errors.Is(err, ErrIncompatible) {
+		t.Errorf("Convert(cup, g) error = %v, want %v", err, ErrIncompatible)
+	}
+}
+
+func mustLookup(t *testing.T, name string) Unit {
+	t.Helper()
+	u, ok := Lookup(name)
+	if !ok {
+		t.Fatalf("Lookup(%q) found nothing", name)
+	}
+	return u
+}
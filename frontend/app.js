@@ -1,6 +1,9 @@
 const API_BASE = 'http://localhost:8080/api';
 
 let currentUser = null;
+let authToken = null;
+let refreshToken = null;
+let refreshing = null;
 let allFoods = [];
 
 // Initialize
@@ -9,6 +12,52 @@ document.addEventListener('DOMContentLoaded', () => {
     document.getElementById('summaryDate').value = today;
 });
 
+// Adds the session token to request headers
+function authHeaders(headers = {}) {
+    return { ...headers, 'Authorization': `Bearer ${authToken}` };
+}
+
+// Fetches with the session token. When the access token has expired it
+// gets a new pair with the refresh token and retries once, logging out if
+// the session can't be refreshed.
+async function apiFetch(url, options = {}) {
+    const send = () => fetch(url, { ...options, headers: authHeaders(options.headers) });
+
+    const used = authToken;
+    const response = await send();
+    if (response.status !== 401 || !refreshToken) {
+        return response;
+    }
+
+    // Another request may have refreshed the session meanwhile
+    if (authToken === used && !(await refreshSession())) {
+        logout();
+        return response;
+    }
+    return send();
+}
+
+// Requests failing together share one refresh, as each refresh token
+// only works once
+function refreshSession() {
+    if (!refreshing) {
+        refreshing = fetch(`${API_BASE}/auth/refresh`, {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ refresh_token: refreshToken })
+        }).then(async response => {
+            if (!response.ok) return false;
+            const session = await response.json();
+            authToken = session.access_token;
+            refreshToken = session.refresh_token;
+            return true;
+        }).catch(() => false).finally(() => {
+            refreshing = null;
+        });
+    }
+    return refreshing;
+}
+
 // Auth Functions
 async function register() {
     const name = document.getElementById('registerName').value;
@@ -23,8 +72,10 @@ async function register() {
         });
 
         if (response.ok) {
-            const user = await response.json();
-            currentUser = user;
+            const session = await response.json();
+            authToken = session.access_token;
+            refreshToken = session.refresh_token;
+            currentUser = session.user;
             showApp();
             alert('Registration successful!');
         } else {
@@ -48,8 +99,10 @@ async function login() {
         });
 
         if (response.ok) {
-            const user = await response.json();
-            currentUser = user;
+            const session = await response.json();
+            authToken = session.access_token;
+            refreshToken = session.refresh_token;
+            currentUser = session.user;
             showApp();
             alert('Login successful!');
         } else {
@@ -62,7 +115,17 @@ async function login() {
 }
 
 function logout() {
+    if (authToken) {
+        fetch(`${API_BASE}/auth/logout`, {
+            method: 'POST',
+            headers: authHeaders({ 'Content-Type': 'application/json' }),
+            body: JSON.stringify({ refresh_token: refreshToken })
+        }).catch(() => {});
+    }
+
     currentUser = null;
+    authToken = null;
+    refreshToken = null;
     document.getElementById('authSection').classList.remove('hidden');
     document.getElementById('authSection').classList.add('active');
     document.getElementById('appSection').classList.add('hidden');
@@ -77,6 +140,7 @@ function showApp() {
 
     // Load initial data
     loadFoods();
+    loadCategories();
     loadEntries();
     loadDailySummary();
     loadGoals();
@@ -104,7 +168,7 @@ function showTab(tabName) {
 // Foods Functions
 async function loadFoods() {
     try {
-        const response = await fetch(`${API_BASE}/foods`);
+        const response = await apiFetch(`${API_BASE}/foods`);
         if (response.ok) {
             allFoods = await response.json();
             displayFoods(allFoods);
@@ -115,6 +179,31 @@ async function loadFoods() {
     }
 }
 
+async function loadCategories() {
+    try {
+        const response = await apiFetch(`${API_BASE}/categories`);
+        if (response.ok) {
+            populateCategorySelect(await response.json());
+        }
+    } catch (err) {
+        alert('Error loading categories: ' + err.message);
+    }
+}
+
+function populateCategorySelect(categories) {
+    const select = document.getElementById('foodCategory');
+    select.innerHTML = '<option value="">None</option>';
+
+    const add = (category, depth) => {
+        const option = document.createElement('option');
+        option.value = category.slug;
+        option.textContent = '\u00a0\u00a0'.repeat(depth) + category.name;
+        select.appendChild(option);
+        (category.children || []).forEach(child => add(child, depth + 1));
+    };
+    categories.forEach(category => add(category, 0));
+}
+
 function displayFoods(foods) {
     const tbody = document.getElementById('foodsTable');
     tbody.innerHTML = '';
@@ -167,14 +256,16 @@ async function addFood() {
     };
 
     try {
-        const response = await fetch(`${API_BASE}/foods`, {
+        const response = await apiFetch(`${API_BASE}/foods`, {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify(food)
         });
 
         if (response.ok) {
-            alert('Food added successfully!');
+            const saved = await response.json();
+            const warnings = (saved.warnings || []).map(w => '\n- ' + w.message).join('');
+            alert('Food added successfully!' + (warnings ? '\n\nPlease double-check:' + warnings : ''));
             hideAddFoodForm();
             loadFoods();
             // Clear form
@@ -186,6 +277,9 @@ async function addFood() {
             document.getElementById('foodFats').value = '';
             document.getElementById('foodServingSize').value = '';
             document.getElementById('foodServingUnit').value = '';
+        } else if (response.status === 422) {
+            const body = await response.json();
+            alert('Failed to add food:' + body.errors.map(e => '\n- ' + e.message).join(''));
         } else {
             const error = await response.text();
             alert('Failed to add food: ' + error);
@@ -199,7 +293,7 @@ async function deleteFood(id) {
     if (!confirm('Are you sure you want to delete this food?')) return;
 
     try {
-        const response = await fetch(`${API_BASE}/foods/${id}`, {
+        const response = await apiFetch(`${API_BASE}/foods/${id}`, {
             method: 'DELETE'
         });
 
@@ -218,7 +312,7 @@ async function deleteFood(id) {
 // Entries Functions
 async function loadEntries() {
     try {
-        const response = await fetch(`${API_BASE}/entries`);
+        const response = await apiFetch(`${API_BASE}/entries`);
         if (response.ok) {
             const entries = await response.json();
             displayEntries(entries);
@@ -298,14 +392,16 @@ async function addEntry() {
     };
 
     try {
-        const response = await fetch(`${API_BASE}/entries`, {
+        const response = await apiFetch(`${API_BASE}/entries`, {
             method: 'POST',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify(entry)
         });
 
         if (response.ok) {
-            alert('Entry logged successfully!');
+            const saved = await response.json();
+            const warnings = (saved.warnings || []).map(w => '\n- ' + w.message).join('');
+            alert('Entry logged successfully!' + (warnings ? '\n\nHeads up:' + warnings : ''));
             hideAddEntryForm();
             loadEntries();
             loadDailySummary();
@@ -322,7 +418,7 @@ async function deleteEntry(id) {
     if (!confirm('Are you sure you want to delete this entry?')) return;
 
     try {
-        const response = await fetch(`${API_BASE}/entries/${id}`, {
+        const response = await apiFetch(`${API_BASE}/entries/${id}`, {
             method: 'DELETE'
         });
 
@@ -344,7 +440,7 @@ async function loadDailySummary() {
     const date = document.getElementById('summaryDate').value;
 
     try {
-        const response = await fetch(`${API_BASE}/nutrition/daily/${date}`);
+        const response = await apiFetch(`${API_BASE}/nutrition/daily/${date}`);
         if (response.ok) {
             const summary = await response.json();
 
@@ -383,7 +479,7 @@ async function loadDailySummary() {
 // Goals Functions
 async function loadGoals() {
     try {
-        const response = await fetch(`${API_BASE}/nutrition/goals`);
+        const response = await apiFetch(`${API_BASE}/nutrition/goals`);
         if (response.ok) {
             const goals = await response.json();
             document.getElementById('goalCalories').value = goals.daily_calorie_goal;
@@ -405,7 +501,7 @@ async function updateGoals() {
     };
 
     try {
-        const response = await fetch(`${API_BASE}/nutrition/goals`, {
+        const response = await apiFetch(`${API_BASE}/nutrition/goals`, {
             method: 'PUT',
             headers: { 'Content-Type': 'application/json' },
             body: JSON.stringify(goals)